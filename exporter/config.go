@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"github.com/ppussar/mongodb_exporter/internal"
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+)
+
+// Configuration types of the exporter, see the README for their yaml representation
+type (
+	Config          = internal.Config
+	HTTP            = internal.HTTP
+	TLS             = internal.TLS
+	Auth            = internal.Auth
+	MongoDB         = internal.MongoDB
+	ReadPreference  = internal.ReadPreference
+	Target          = internal.Target
+	Collection      = internal.Collection
+	InternalMetrics = internal.InternalMetrics
+	Builtin         = internal.Builtin
+	Discovery       = internal.Discovery
+	CurrentOp       = internal.CurrentOp
+	Metric          = internal.Metric
+	MetricValue     = internal.MetricValue
+)
+
+// Connection types, which allow to provide own MongoDB connections via a ConnectionFactory
+type (
+	IConnection   = wrapper.IConnection
+	ICursor       = wrapper.ICursor
+	ISingleResult = wrapper.ISingleResult
+	IChangeStream = wrapper.IChangeStream
+	ResumeToken   = wrapper.ResumeToken
+	QueryOptions  = wrapper.QueryOptions
+)
+
+// ConnectionFactory opens the connection to the given target
+type ConnectionFactory func(target Target) (IConnection, error)
+
+// ReadConfigFile initializes a Config instance from a given file path, including environment variable overrides
+func ReadConfigFile(configFile string) (Config, error) {
+	return internal.ReadConfigFile(configFile)
+}
+
+// ReadConfig parses the given config content, including environment variable overrides
+func ReadConfig(data []byte) (Config, error) {
+	return internal.ReadConfig(data)
+}
+
+// NewConnection opens a connection to the MongoDB deployment of the given target
+// It is used if no other ConnectionFactory is given.
+func NewConnection(target Target) (IConnection, error) {
+	return internal.NewConnection(target.URI)
+}
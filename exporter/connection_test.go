@@ -0,0 +1,61 @@
+package exporter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/exporter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// customConnection implements IConnection with the exported types only, like a connection of an embedding service
+type customConnection struct{}
+
+var _ exporter.IConnection = customConnection{}
+
+func (customConnection) Aggregate(context.Context, string, string, bson.A, exporter.QueryOptions) (exporter.ICursor, error) {
+	return nil, nil
+}
+
+func (customConnection) Find(context.Context, string, string, bson.D, exporter.QueryOptions) (exporter.ICursor, error) {
+	return nil, nil
+}
+
+func (customConnection) RunCommand(context.Context, string, bson.D, exporter.QueryOptions) (exporter.ISingleResult, error) {
+	return nil, nil
+}
+
+func (customConnection) ListCollectionNames(context.Context, string, bson.D) ([]string, error) {
+	return nil, nil
+}
+
+func (customConnection) Watch(context.Context, string, string, bson.A, exporter.ResumeToken, exporter.QueryOptions) (exporter.IChangeStream, error) {
+	return nil, nil
+}
+
+func (customConnection) Disconnect(context.Context) error {
+	return nil
+}
+
+func TestCustomConnection(t *testing.T) {
+	config, err := exporter.ReadConfig([]byte(`
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+metrics:
+  - name: test_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+`))
+	assert.NoError(t, err)
+
+	_, err = exporter.New(config, func(exporter.Target) (exporter.IConnection, error) {
+		return customConnection{}, nil
+	}, nil)
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,352 @@
+// Package exporter collects prometheus metrics from MongoDB queries
+// It can be embedded into other Go services or served by the mongodb_exporter binary.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal"
+	"github.com/ppussar/mongodb_exporter/internal/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var log = logger.GetInstance()
+
+// disconnectTimeout limits how long a replaced connection waits for its running queries before it is closed
+const disconnectTimeout = 30 * time.Second
+
+// An Exporter queries MongoDB deployments to gather the configured metrics
+type Exporter struct {
+	config   Config
+	connect  ConnectionFactory
+	registry *prometheus.Registry
+	metrics  *internal.Metrics
+	targets  map[string]*targetState
+	limiter  *internal.Limiter
+	mu       sync.RWMutex
+	ctx      context.Context
+}
+
+// targetState holds the connection and the registered collectors of one target
+type targetState struct {
+	target     Target
+	con        IConnection
+	errorC     chan error
+	collectors []*managedCollector
+	builtins   []internal.BuiltinCollector
+	registered bool
+}
+
+// managedCollector is a registered collector together with the metric it was created from
+type managedCollector struct {
+	*internal.Collector
+	metric Metric
+	ctx    context.Context
+	stop   context.CancelFunc
+}
+
+// New creates an Exporter for the given config
+// The config is validated and completed with the mongodb query defaults like by ReadConfig.
+// Connections are opened by the given factory, or by NewConnection if it is nil.
+// The collected and internal metrics are registered with the given registry. Without registry,
+// the exporter creates its own one, including the Go and process collectors selected in the config.
+// A registry can only be used by one exporter.
+func New(config Config, connect ConnectionFactory, registry *prometheus.Registry) (*Exporter, error) {
+	config, err := internal.PrepareConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCollectors(config); err != nil {
+		return nil, err
+	}
+	if connect == nil {
+		connect = NewConnection
+	}
+	if registry == nil {
+		registry = newRegistry(config.InternalMetrics)
+	}
+
+	metrics := internal.NewMetrics(registry)
+	e := &Exporter{
+		config:   config,
+		connect:  connect,
+		registry: registry,
+		metrics:  metrics,
+		targets:  make(map[string]*targetState),
+		limiter:  newLimiter(config.Collection, metrics),
+	}
+	for _, target := range config.MongoTargets() {
+		e.targets[target.Name] = &targetState{
+			target: target,
+			errorC: make(chan error, 10), // Buffered to prevent blocking
+		}
+	}
+	if err := registry.Register(configuredCollectors{e}); err != nil {
+		return nil, err
+	}
+	metrics.ConfigLastReloadSuccessful.Set(1)
+	metrics.ConfigHash.Set(config.Hash())
+	return e, nil
+}
+
+// newRegistry creates the registry of the exporter, including the enabled runtime collectors
+func newRegistry(c InternalMetrics) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	if !c.DisableGoCollector {
+		registry.MustRegister(collectors.NewGoCollector())
+	}
+	if !c.DisableProcessCollector {
+		registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	return registry
+}
+
+// newLimiter returns a Limiter for the configured concurrency limits, or nil if queries are unlimited
+func newLimiter(c Collection, metrics *internal.Metrics) *internal.Limiter {
+	if c.MaxConcurrency <= 0 && c.MaxConcurrencyPerDatabase <= 0 {
+		return nil
+	}
+	return internal.NewLimiter(c.MaxConcurrency, c.MaxConcurrencyPerDatabase, metrics)
+}
+
+// Start connects to all targets and registers their collectors as soon as they are connected
+// Collection stops when the given context is done.
+func (e *Exporter) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ctx != nil {
+		return fmt.Errorf("exporter already started")
+	}
+	e.ctx = ctx
+	for _, state := range e.targets {
+		go e.run(ctx, state)
+	}
+	log.Info("Started")
+	return nil
+}
+
+// Serve serves the http endpoints of the config until the given context is done
+// The reload endpoint, if configured, calls the given reload function. Errors, e.g. of a port already in use or an
+// invalid certificate, are returned instead of ending the process.
+func (e *Exporter) Serve(ctx context.Context, reload func() error) error {
+	srv := internal.NewHttpServer(e.currentConfig(), e.registry)
+	srv.EnableProbe(e.currentConfig, e.connection, e.metrics)
+	if reload != nil {
+		srv.EnableReload(reload)
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	if err := srv.Start(wg); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-srv.Errors():
+		wg.Wait()
+		return err
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	wg.Wait()
+	return err
+}
+
+// Collectors returns the collectors of the configured metrics and built-in collectors for all connected targets
+func (e *Exporter) Collectors() []prometheus.Collector {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.targets))
+	for name := range e.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]prometheus.Collector, 0)
+	for _, name := range names {
+		for _, collector := range e.targets[name].collectors {
+			result = append(result, collector.Collector)
+		}
+		for _, builtin := range e.targets[name].builtins {
+			result = append(result, builtin)
+		}
+	}
+	return result
+}
+
+// run opens the connection to the given target and registers its collectors
+// The connection is re-established whenever one of its collectors reports a connection error; the replaced
+// connection is disconnected.
+func (e *Exporter) run(ctx context.Context, state *targetState) {
+	target := state.target
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		con, err := e.connect(target)
+		if err != nil {
+			e.metrics.ConnectionStatus.WithLabelValues(target.Name).Set(0)
+			log.Info(fmt.Sprintf("Error during connection creation%s: %v; Retry in 2s...", targetSuffix(target), err))
+			select {
+			case <-time.After(2 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if con != nil {
+			if e.limiter != nil {
+				con = internal.NewLimitedConnection(con, e.limiter, target.Name)
+			}
+			e.metrics.ConnectionStatus.WithLabelValues(target.Name).Set(1)
+			e.mu.Lock()
+			replaced := state.con
+			state.con = con
+			if !state.registered {
+				e.registerCollectors(state, e.config.MetricsFor(target))
+				state.builtins = internal.NewBuiltinCollectors(e.config, target, con, state.errorC, e.metrics)
+				state.registered = true
+			} else {
+				updateCollectorConnection(state.collectors, con)
+				for _, builtin := range state.builtins {
+					builtin.UpdateConnection(con)
+				}
+			}
+			e.mu.Unlock()
+			if replaced != nil {
+				go disconnect(replaced, target)
+			}
+		}
+
+		select {
+		case err := <-state.errorC:
+			e.metrics.ConnectionStatus.WithLabelValues(target.Name).Set(0)
+			log.Error(fmt.Sprintf("Collector error%s: %v", targetSuffix(target), err))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// disconnect closes a replaced connection once its running queries are done, or after disconnectTimeout
+func disconnect(con IConnection, target Target) {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	if err := con.Disconnect(ctx); err != nil {
+		log.Error(fmt.Sprintf("Error during disconnect%s: %v", targetSuffix(target), err))
+	}
+}
+
+// connection returns the current connection of the target with the given name
+func (e *Exporter) connection(target string) (IConnection, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	state, exists := e.targets[target]
+	if !exists || state.con == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return state.con, nil
+}
+
+// currentConfig returns the config which is currently applied
+func (e *Exporter) currentConfig() Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.config
+}
+
+// targetSuffix names the target in log messages
+func targetSuffix(target Target) string {
+	if target.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (target %s)", target.Name)
+}
+
+// registerCollectors creates and starts a collector for every given metric of the target
+// Must be called with e.mu held
+func (e *Exporter) registerCollectors(state *targetState, configs []Metric) {
+	for _, c := range configs {
+		collector := e.newCollector(state, c)
+		log.Info("Register new collector: " + collector.String())
+		state.collectors = append(state.collectors, collector)
+		collector.start()
+	}
+}
+
+// newCollector creates the collector of the given metric for the target without starting it
+// Must be called with e.mu held
+func (e *Exporter) newCollector(state *targetState, m Metric) *managedCollector {
+	ctx, stop := context.WithCancel(e.ctx)
+	return &managedCollector{
+		Collector: internal.NewCollector(m, state.con, state.errorC, e.metrics),
+		metric:    m,
+		ctx:       ctx,
+		stop:      stop,
+	}
+}
+
+// start runs the background schedule of the collector, if an interval is configured,
+// or consumes its change stream
+func (c *managedCollector) start() {
+	if c.metric.Interval > 0 {
+		go schedule(c.ctx, c.Collector, c.metric.Interval)
+	}
+	if c.metric.ChangeStream != "" {
+		go c.Watch(c.ctx)
+	}
+}
+
+// schedule refreshes the cached result of the given collector in the configured interval until the context is done
+func schedule(ctx context.Context, collector *internal.Collector, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		collector.Refresh()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func updateCollectorConnection(collectors []*managedCollector, con IConnection) {
+	for _, curCollector := range collectors {
+		log.Info("Update connection in collector: " + curCollector.String())
+		curCollector.UpdateConnection(con)
+	}
+}
+
+// configuredCollectors exposes the collectors of the exporter in its registry
+// It is an unchecked collector, since the collectors change on reload.
+type configuredCollectors struct {
+	exporter *Exporter
+}
+
+// Describe sends no descriptors, which makes it an unchecked collector
+func (c configuredCollectors) Describe(chan<- *prometheus.Desc) {}
+
+// Collect collects the metrics of all collectors of the exporter concurrently, like the registry does for
+// registered collectors, so that a scrape takes as long as the slowest query instead of all queries together
+func (c configuredCollectors) Collect(ch chan<- prometheus.Metric) {
+	wg := &sync.WaitGroup{}
+	for _, collector := range c.exporter.Collectors() {
+		wg.Add(1)
+		go func(collector prometheus.Collector) {
+			defer wg.Done()
+			collector.Collect(ch)
+		}(collector)
+	}
+	wg.Wait()
+}
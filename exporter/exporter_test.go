@@ -0,0 +1,485 @@
+package exporter
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal"
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  internal.Config
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "valid config",
+			config: internal.Config{
+				HTTP: internal.HTTP{Port: 9090},
+				MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             "{}",
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid port",
+			config: internal.Config{
+				HTTP: internal.HTTP{Port: -1},
+				MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             "{}",
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: true,
+			errMsg:  "invalid HTTP port: -1",
+		},
+		{
+			name: "empty MongoDB URI",
+			config: internal.Config{
+				HTTP: internal.HTTP{Port: 9090},
+				MongoDb: internal.MongoDB{URI: ""},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             "{}",
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: true,
+			errMsg:  "MongoDB URI cannot be empty",
+		},
+		{
+			name: "invalid metric type",
+			config: internal.Config{
+				HTTP:    internal.HTTP{Port: 9090},
+				MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Type:             "bogus",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             "{}",
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: unsupported metric type 'bogus'",
+		},
+		{
+			name: "malformed query",
+			config: internal.Config{
+				HTTP:    internal.HTTP{Port: 9090},
+				MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             `{"a": `,
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: invalid query",
+		},
+		{
+			name: "targets without MongoDB URI",
+			config: internal.Config{
+				HTTP:    internal.HTTP{Port: 9090},
+				Targets: []internal.Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []internal.Metric{{
+					Name:             "test_metric",
+					Db:               "testdb",
+					Collection:       "testcol",
+					Find:             "{}",
+					MetricsAttribute: "count",
+				}},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.config, nil, prometheus.NewRegistry())
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	config := internal.Config{
+		HTTP: internal.HTTP{Port: 9090},
+		MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+		}},
+	}
+
+	exporter, err := New(config, nil, nil)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, exporter)
+	assert.NotNil(t, exporter.registry)
+	assert.Equal(t, config, exporter.config)
+	assert.Equal(t, 1, len(exporter.targets))
+	assert.Empty(t, exporter.targets[""].collectors)
+	assert.Empty(t, exporter.Collectors())
+}
+
+func TestNewExporterAppliesQueryDefaults(t *testing.T) {
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017", Timeout: 5 * time.Second, ReadConcern: "majority"},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+		}},
+	}
+
+	e, err := New(config, nil, prometheus.NewRegistry())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, e.config.Metrics[0].Timeout)
+	assert.Equal(t, "majority", e.config.Metrics[0].ReadConcern)
+	assert.Zero(t, config.Metrics[0].Timeout, "the given config is not modified")
+}
+
+func TestNewExporterRejectsConflictingMetrics(t *testing.T) {
+	metric := internal.Metric{
+		Name:             "test_metric",
+		Db:               "testdb",
+		Collection:       "testcol",
+		Find:             "{}",
+		MetricsAttribute: "count",
+	}
+	conflicting := metric
+	conflicting.TagAttributes = map[string]string{"type": "_id"}
+
+	_, err := New(internal.Config{HTTP: internal.HTTP{Port: 9090}, MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"}, Metrics: []internal.Metric{metric, conflicting}}, nil, nil)
+
+	assert.ErrorContains(t, err, "metric test_metric")
+}
+
+func TestExporterRegistry(t *testing.T) {
+	metric := internal.Metric{
+		Name:             "test_metric",
+		Db:               "testdb",
+		Collection:       "testcol",
+		Find:             "{}",
+		MetricsAttribute: "count",
+	}
+	familyNames := func(e *Exporter) []string {
+		families, err := e.registry.Gather()
+		assert.NoError(t, err)
+		names := make([]string, 0, len(families))
+		for _, f := range families {
+			names = append(names, f.GetName())
+		}
+		return names
+	}
+
+	t.Run("runs several exporters in one process", func(t *testing.T) {
+		config := internal.Config{HTTP: internal.HTTP{Port: 9090}, MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"}, Metrics: []internal.Metric{metric}}
+		first, err := New(config, nil, nil)
+		assert.NoError(t, err)
+		second, err := New(config, nil, nil)
+		assert.NoError(t, err)
+
+		assert.NotSame(t, first.registry, second.registry)
+		assert.Contains(t, familyNames(first), "mongodb_exporter_config_hash")
+		assert.Contains(t, familyNames(first), "go_goroutines")
+	})
+
+	t.Run("registers with a given registry", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		config := internal.Config{HTTP: internal.HTTP{Port: 9090}, MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"}, Metrics: []internal.Metric{metric}}
+		e, err := New(config, nil, registry)
+
+		assert.NoError(t, err)
+		assert.Same(t, registry, e.registry)
+		assert.Contains(t, familyNames(e), "mongodb_exporter_config_hash")
+		assert.NotContains(t, familyNames(e), "go_goroutines")
+	})
+
+	t.Run("excludes runtime collectors", func(t *testing.T) {
+		config := internal.Config{
+			HTTP:            internal.HTTP{Port: 9090},
+			MongoDb:         internal.MongoDB{URI: "mongodb://localhost:27017"},
+			Metrics:         []internal.Metric{metric},
+			InternalMetrics: internal.InternalMetrics{DisableGoCollector: true, DisableProcessCollector: true},
+		}
+		e, err := New(config, nil, nil)
+		assert.NoError(t, err)
+
+		for _, name := range familyNames(e) {
+			assert.NotContains(t, name, "go_")
+			assert.NotContains(t, name, "process_")
+		}
+	})
+}
+
+func TestExporterStart(t *testing.T) {
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		Targets: []internal.Target{{Name: "a", URI: "mongodb://a:27017"}, {Name: "b", URI: "mongodb://b:27017"}},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+		}},
+	}
+	connected := make(chan string, 2)
+	connect := func(target Target) (IConnection, error) {
+		connected <- target.Name
+		return &mocks.IConnection{}, nil
+	}
+	e, err := New(config, connect, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, e.Start(ctx))
+
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{<-connected, <-connected})
+	assert.Eventually(t, func() bool {
+		return len(e.Collectors()) == 2
+	}, time.Second, 10*time.Millisecond, "collectors of both targets are registered")
+	assert.ErrorContains(t, e.Start(ctx), "already started")
+}
+
+func TestServeReturnsErrors(t *testing.T) {
+	inUse, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer inUse.Close()
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: inUse.Addr().(*net.TCPAddr).Port, Prometheus: "/metrics", Health: "/health", Liveliness: "/live"},
+		MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+		}},
+	}
+	e, err := New(config, nil, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	err = e.Serve(context.Background(), nil)
+
+	assert.ErrorContains(t, err, "address already in use")
+}
+
+func TestCollectConcurrently(t *testing.T) {
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		Targets: []internal.Target{{Name: "a", URI: "mongodb://a:27017"}, {Name: "b", URI: "mongodb://b:27017"}},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+		}},
+	}
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	connect := func(target Target) (IConnection, error) {
+		cursor := &mocks.ICursor{}
+		cursor.On("Next", mock.Anything).Return(false)
+		cursor.On("Err").Return(nil)
+		cursor.On("Close", mock.Anything).Return(nil)
+		con := &mocks.IConnection{}
+		con.On("Find", mock.Anything, "testdb", "testcol", driverbson.D{}, mock.Anything).Return(cursor, nil).Run(func(mock.Arguments) {
+			started <- struct{}{}
+			<-release
+		})
+		return con, nil
+	}
+	e, err := New(config, connect, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, e.Start(ctx))
+	assert.Eventually(t, func() bool {
+		return len(e.Collectors()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	gathered := make(chan error, 1)
+	go func() {
+		_, err := e.registry.Gather()
+		gathered <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("the queries of both targets should run at once")
+		}
+	}
+	close(release)
+	assert.NoError(t, <-gathered)
+}
+
+func TestReconnect(t *testing.T) {
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		Targets: []internal.Target{{Name: "a", URI: "mongodb://a:27017"}},
+		Metrics: []internal.Metric{{
+			Name:             "test_metric",
+			Db:               "testdb",
+			Collection:       "testcol",
+			Find:             "{}",
+			MetricsAttribute: "count",
+			Interval:         10 * time.Millisecond,
+		}},
+	}
+	lost := &mocks.IConnection{}
+	lost.On("Find", mock.Anything, "testdb", "testcol", driverbson.D{}, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+	disconnected := make(chan struct{})
+	lost.On("Disconnect", mock.Anything).Return(nil).Run(func(mock.Arguments) { close(disconnected) }).Once()
+	rejecting := &mocks.IConnection{}
+	rejecting.On("Find", mock.Anything, "testdb", "testcol", driverbson.D{}, mock.Anything).Return(nil, mongo.CommandError{Code: 13, Name: "Unauthorized"})
+
+	var connections atomic.Int32
+	connect := func(target Target) (IConnection, error) {
+		if connections.Add(1) == 1 {
+			return lost, nil
+		}
+		return rejecting, nil
+	}
+	e, err := New(config, connect, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, e.Start(ctx))
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the connection replaced after a connection error should be disconnected")
+	}
+	// The rejected queries run every 10ms, but fail again with a new connection
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), connections.Load())
+}
+
+func TestChangeStreamServerErrorDoesNotReconnect(t *testing.T) {
+	config := internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		Targets: []internal.Target{{Name: "a", URI: "mongodb://a:27017"}},
+		Metrics: []internal.Metric{{
+			Name:         "test_changes_total",
+			Db:           "testdb",
+			Collection:   "testcol",
+			ChangeStream: "[]",
+		}},
+	}
+	watched := make(chan struct{}, 10)
+	con := &mocks.IConnection{}
+	// A standalone server has no change streams
+	con.On("Watch", mock.Anything, "testdb", "testcol", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, mongo.CommandError{Code: 40573, Name: "Location40573"}).Run(func(mock.Arguments) { watched <- struct{}{} })
+
+	var connections atomic.Int32
+	connect := func(target Target) (IConnection, error) {
+		connections.Add(1)
+		return con, nil
+	}
+	e, err := New(config, connect, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, e.Start(ctx))
+
+	select {
+	case <-watched:
+	case <-time.After(time.Second):
+		t.Fatal("the change stream should be opened")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), connections.Load(), "a server side error must not open a new connection")
+	assert.Len(t, watched, 0, "the stream is retried after the retry interval only")
+}
+
+func TestSchedule(t *testing.T) {
+	metric := internal.Metric{
+		Name:             "test_scheduled_metric",
+		Db:               "testdb",
+		Collection:       "testcol",
+		Find:             "{}",
+		MetricsAttribute: "count",
+		Interval:         time.Hour,
+	}
+	cursor := &mocks.ICursor{}
+	cursor.On("Next", mock.Anything).Return(true).Once()
+	cursor.On("Next", mock.Anything).Return(false).Once()
+	cursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*bson.M) = bson.M{"count": int32(7)}
+	}).Once()
+	cursor.On("Err").Return(nil).Once()
+	cursor.On("Close", mock.Anything).Return(nil).Once()
+	con := &mocks.IConnection{}
+	con.On("Find", mock.Anything, metric.Db, metric.Collection, driverbson.D{}, mock.Anything).Return(cursor, nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collector := internal.NewCollector(metric, con, make(chan error, 1), internal.NewMetrics(prometheus.NewRegistry()))
+
+	done := make(chan struct{})
+	go func() {
+		schedule(ctx, collector, metric.Interval)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		ch := make(chan prometheus.Metric, 1)
+		collector.Collect(ch)
+		return len(ch) == 1
+	}, time.Second, 10*time.Millisecond, "first refresh runs immediately")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("schedule should stop when the context is cancelled")
+	}
+	con.AssertExpectations(t)
+}
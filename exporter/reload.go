@@ -0,0 +1,150 @@
+package exporter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ppussar/mongodb_exporter/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReloadFile reads the given config file and applies its metrics like Reload
+func (e *Exporter) ReloadFile(configFile string) error {
+	config, err := internal.ReadConfigFile(configFile)
+	if err != nil {
+		e.metrics.ConfigLastReloadSuccessful.Set(0)
+		return fmt.Errorf("config reload failed: %w", err)
+	}
+	return e.Reload(config)
+}
+
+// Reload applies the metrics of the given config
+// Unchanged collectors keep running, removed and changed ones are stopped and new ones are started at once.
+// The config is validated and completed like by New. It is rejected as a whole if it changes sections which require a restart or if its collectors conflict.
+// The outcome is reported by the config reload metrics.
+func (e *Exporter) Reload(config Config) error {
+	config, err := internal.PrepareConfig(config)
+	if err == nil {
+		err = e.reload(config)
+	}
+	if err != nil {
+		e.metrics.ConfigLastReloadSuccessful.Set(0)
+		return fmt.Errorf("config reload failed: %w", err)
+	}
+
+	e.metrics.ConfigLastReloadSuccessful.Set(1)
+	e.metrics.ConfigLastReloadSuccessTimestamp.SetToCurrentTime()
+	e.metrics.ConfigHash.Set(config.Hash())
+	log.Info("Config reloaded")
+	return nil
+}
+
+func (e *Exporter) reload(config Config) error {
+	e.mu.RLock()
+	current := e.config
+	e.mu.RUnlock()
+
+	if err := checkReloadable(current, config); err != nil {
+		return err
+	}
+	if err := checkCollectors(config); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, state := range e.targets {
+		// Collectors of targets which are not connected yet are registered with the new config on connect
+		if !state.registered {
+			continue
+		}
+		c := e.diffCollectors(state, config.MetricsFor(state.target))
+		for _, collector := range c.removed {
+			log.Info("Unregister collector: " + collector.String())
+			collector.stop()
+		}
+		for _, collector := range c.added {
+			log.Info("Register new collector: " + collector.String())
+			collector.start()
+		}
+		state.collectors = c.collectors
+	}
+	e.config = config
+	return nil
+}
+
+// collectorChanges describes how the collectors of a target change on reload
+type collectorChanges struct {
+	collectors []*managedCollector
+	added      []*managedCollector
+	removed    []*managedCollector
+}
+
+// diffCollectors keeps the collectors of the target whose metric is unchanged and creates new ones for all other metrics
+// Must be called with e.mu held
+func (e *Exporter) diffCollectors(state *targetState, metrics []Metric) collectorChanges {
+	remaining := append([]*managedCollector(nil), state.collectors...)
+	c := collectorChanges{collectors: make([]*managedCollector, 0, len(metrics))}
+
+	for _, m := range metrics {
+		idx := indexOfMetric(remaining, m)
+		if idx < 0 {
+			collector := e.newCollector(state, m)
+			c.added = append(c.added, collector)
+			c.collectors = append(c.collectors, collector)
+			continue
+		}
+		c.collectors = append(c.collectors, remaining[idx])
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+	}
+	c.removed = remaining
+	return c
+}
+
+func indexOfMetric(collectors []*managedCollector, m Metric) int {
+	for i, c := range collectors {
+		if reflect.DeepEqual(c.metric, m) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkReloadable rejects changes of config sections which are only applied on startup
+func checkReloadable(current Config, next Config) error {
+	if !reflect.DeepEqual(current.HTTP, next.HTTP) {
+		return fmt.Errorf("changes of the http section require a restart")
+	}
+	if current.MongoDb.URI != next.MongoDb.URI || !reflect.DeepEqual(current.Targets, next.Targets) {
+		return fmt.Errorf("changes of mongodb.uri or targets require a restart")
+	}
+	if current.Collection != next.Collection {
+		return fmt.Errorf("changes of the collection section require a restart")
+	}
+	if current.InternalMetrics != next.InternalMetrics {
+		return fmt.Errorf("changes of the internalMetrics section require a restart")
+	}
+	if !reflect.DeepEqual(current.Builtin, next.Builtin) {
+		return fmt.Errorf("changes of the builtin section require a restart")
+	}
+	return nil
+}
+
+// checkCollectors registers the collectors of all targets in a scratch registry to detect conflicts
+// before any collector of the running exporter is replaced
+func checkCollectors(config Config) error {
+	registry := prometheus.NewRegistry()
+	for _, target := range config.MongoTargets() {
+		for _, builtin := range internal.NewBuiltinCollectors(config, target, nil, nil, nil) {
+			if err := registry.Register(builtin); err != nil {
+				return fmt.Errorf("builtin collector: %w", err)
+			}
+		}
+		for _, m := range config.MetricsFor(target) {
+			if err := registry.Register(internal.NewCollector(m, nil, nil, nil)); err != nil {
+				return fmt.Errorf("metric %s: %w", m.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/internal"
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func reloadTestConfig(metrics ...internal.Metric) internal.Config {
+	return internal.Config{
+		HTTP:    internal.HTTP{Port: 9090},
+		MongoDb: internal.MongoDB{URI: "mongodb://localhost:27017"},
+		Metrics: metrics,
+	}
+}
+
+func reloadTestMetric(name string, help string) internal.Metric {
+	return internal.Metric{
+		Name:             name,
+		Help:             help,
+		Db:               "testdb",
+		Collection:       "testcol",
+		Find:             "{}",
+		MetricsAttribute: "count",
+	}
+}
+
+// connectedExporter returns an exporter whose collectors are registered as after a successful connect
+func connectedExporter(t *testing.T, config internal.Config) *Exporter {
+	e, err := New(config, nil, prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	state := e.targets[""]
+	state.con = &mocks.IConnection{}
+	e.mu.Lock()
+	e.ctx = ctx
+	e.registerCollectors(state, config.MetricsFor(state.target))
+	state.registered = true
+	e.mu.Unlock()
+	return e
+}
+
+func TestReload(t *testing.T) {
+	t.Run("keeps unchanged, replaces changed and adds new collectors", func(t *testing.T) {
+		unchanged := reloadTestMetric("reload_unchanged", "help")
+		changed := reloadTestMetric("reload_changed", "help")
+		removed := reloadTestMetric("reload_removed", "help")
+		e := connectedExporter(t, reloadTestConfig(unchanged, changed, removed))
+		state := e.targets[""]
+		unchangedCollector := state.collectors[0]
+		changedCollector := state.collectors[1]
+		removedCollector := state.collectors[2]
+
+		next := reloadTestConfig(unchanged, reloadTestMetric("reload_changed", "new help"), reloadTestMetric("reload_added", "help"))
+		assert.NoError(t, e.reload(next))
+
+		assert.Equal(t, 3, len(state.collectors))
+		assert.Same(t, unchangedCollector, state.collectors[0])
+		assert.NotSame(t, changedCollector, state.collectors[1])
+		assert.Equal(t, "new help", state.collectors[1].metric.Help)
+		assert.Equal(t, "reload_added", state.collectors[2].metric.Name)
+		assert.Equal(t, next, e.currentConfig())
+		assert.NotContains(t, e.Collectors(), removedCollector.Collector)
+		assert.Error(t, removedCollector.ctx.Err(), "removed collectors are stopped")
+	})
+
+	t.Run("rejects changes which require a restart", func(t *testing.T) {
+		metric := reloadTestMetric("reload_restart", "help")
+		e := connectedExporter(t, reloadTestConfig(metric))
+
+		next := reloadTestConfig(metric)
+		next.HTTP.Port = 8080
+		assert.ErrorContains(t, e.reload(next), "http section require a restart")
+
+		next = reloadTestConfig(metric)
+		next.MongoDb.URI = "mongodb://other:27017"
+		assert.ErrorContains(t, e.reload(next), "require a restart")
+
+		next = reloadTestConfig(metric)
+		next.Builtin.ServerStatus = true
+		assert.ErrorContains(t, e.reload(next), "builtin section require a restart")
+	})
+
+	t.Run("rejects conflicting collectors without changing the registered ones", func(t *testing.T) {
+		metric := reloadTestMetric("reload_conflict", "help")
+		e := connectedExporter(t, reloadTestConfig(metric))
+		state := e.targets[""]
+		registered := state.collectors[0]
+
+		conflicting := reloadTestMetric("reload_conflict", "help")
+		conflicting.TagAttributes = map[string]string{"type": "_id"}
+		err := e.reload(reloadTestConfig(metric, conflicting))
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, len(state.collectors))
+		assert.Same(t, registered, state.collectors[0])
+	})
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "configuration.yaml")
+	writeConfig := func(content string) {
+		assert.NoError(t, os.WriteFile(configFile, []byte(content), 0o600))
+	}
+	writeConfig(`
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+metrics:
+  - name: reload_file_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+`)
+	config, err := ReadConfigFile(configFile)
+	assert.NoError(t, err)
+	e := connectedExporter(t, config)
+
+	writeConfig("metrics: [")
+	assert.Error(t, e.ReloadFile(configFile))
+	assert.Equal(t, 0.0, testutil.ToFloat64(e.metrics.ConfigLastReloadSuccessful))
+
+	writeConfig(`
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+metrics:
+  - name: reload_file_metric
+    help: changed
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+`)
+	assert.NoError(t, e.ReloadFile(configFile))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.ConfigLastReloadSuccessful))
+	assert.Equal(t, e.currentConfig().Hash(), testutil.ToFloat64(e.metrics.ConfigHash))
+	assert.Equal(t, "changed", e.targets[""].collectors[0].metric.Help)
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"fmt"
+	netHttp "net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Names of the http endpoints, as used in the http config section
+const (
+	EndpointPrometheus = "prometheus"
+	EndpointHealth     = "health"
+	EndpointLiveliness = "liveliness"
+	EndpointProbe      = "probe"
+	EndpointReload     = "reload"
+)
+
+// defaultProtectedEndpoints leaves the endpoints used by orchestration probes open
+var defaultProtectedEndpoints = []string{EndpointPrometheus, EndpointProbe, EndpointReload}
+
+// dummyHash is compared for unknown users, so that the response time does not reveal which users exist
+var dummyHash = []byte("$2a$10$jTnGLjXG5LWBJGuS9xyszOKvzNc4OcKL3sPO9KiAFI3rl8Rof2c62")
+
+func validateAuth(a Auth) error {
+	if len(a.BasicAuthUsers) == 0 && len(a.BearerTokenFiles) == 0 {
+		return fmt.Errorf("basic_auth_users or bearer_token_files are required")
+	}
+	for user, hash := range a.BasicAuthUsers {
+		if strings.Contains(user, ":") {
+			return fmt.Errorf("basic auth user '%s' must not contain ':'", user)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("basic auth user '%s': password must be a bcrypt hash: %w", user, err)
+		}
+	}
+	for _, endpoint := range a.Endpoints {
+		switch endpoint {
+		case EndpointPrometheus, EndpointHealth, EndpointLiveliness, EndpointProbe, EndpointReload:
+		default:
+			return fmt.Errorf("unknown endpoint '%s'", endpoint)
+		}
+	}
+	return nil
+}
+
+// authenticator checks the credentials of requests to the protected endpoints
+type authenticator struct {
+	users     map[string][]byte
+	tokens    [][]byte
+	endpoints map[string]bool
+}
+
+// newAuthenticator reads the bearer token files of the given config
+func newAuthenticator(a Auth) (*authenticator, error) {
+	if err := validateAuth(a); err != nil {
+		return nil, err
+	}
+	auth := &authenticator{
+		users:     make(map[string][]byte, len(a.BasicAuthUsers)),
+		endpoints: make(map[string]bool),
+	}
+	for user, hash := range a.BasicAuthUsers {
+		auth.users[user] = []byte(hash)
+	}
+	for _, file := range a.BearerTokenFiles {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token file: %w", err)
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return nil, fmt.Errorf("bearer token file %s is empty", file)
+		}
+		auth.tokens = append(auth.tokens, []byte(token))
+	}
+	endpoints := a.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = defaultProtectedEndpoints
+	}
+	for _, endpoint := range endpoints {
+		auth.endpoints[endpoint] = true
+	}
+	return auth, nil
+}
+
+// protect wraps the handler of the given endpoint, if the endpoint requires authentication
+func (a *authenticator) protect(endpoint string, handler netHttp.Handler) netHttp.Handler {
+	if a == nil || !a.endpoints[endpoint] {
+		return handler
+	}
+	return netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		if a.authenticated(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if len(a.users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mongodb_exporter"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		netHttp.Error(w, "Unauthorized", netHttp.StatusUnauthorized)
+	})
+}
+
+func (a *authenticator) authenticated(r *netHttp.Request) bool {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return a.validToken([]byte(token))
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok || len(a.users) == 0 {
+		return false
+	}
+	hash, exists := a.users[user]
+	if !exists {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+func (a *authenticator) validToken(token []byte) bool {
+	valid := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t, token) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
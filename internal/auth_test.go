@@ -0,0 +1,153 @@
+package internal
+
+import (
+	netHttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secretHash is the bcrypt hash of "secret"
+const secretHash = "$2a$04$ArZz8ipg.NjBBYFI5Vm8LODylOOgss6Jrke0rYUdmHk3iJgfa3GzS"
+
+func TestValidateAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        Auth
+		expectedErr string
+	}{
+		{
+			name: "valid config",
+			auth: Auth{BasicAuthUsers: map[string]string{"prometheus": secretHash}, Endpoints: []string{"prometheus", "reload"}},
+		},
+		{
+			name:        "no credentials",
+			auth:        Auth{Endpoints: []string{"prometheus"}},
+			expectedErr: "basic_auth_users or bearer_token_files are required",
+		},
+		{
+			name:        "plain text password",
+			auth:        Auth{BasicAuthUsers: map[string]string{"prometheus": "secret"}},
+			expectedErr: "password must be a bcrypt hash",
+		},
+		{
+			name:        "unknown endpoint",
+			auth:        Auth{BearerTokenFiles: []string{"token"}, Endpoints: []string{"metrics"}},
+			expectedErr: "unknown endpoint 'metrics'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAuth(tt.auth)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t-token\n"), 0o600))
+
+	auth, err := newAuthenticator(Auth{
+		BasicAuthUsers:   map[string]string{"prometheus": secretHash},
+		BearerTokenFiles: []string{tokenFile},
+	})
+	require.NoError(t, err)
+
+	ok := netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.WriteHeader(netHttp.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		endpoint       string
+		prepare        func(r *netHttp.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "rejects requests without credentials",
+			endpoint:       EndpointPrometheus,
+			prepare:        func(r *netHttp.Request) {},
+			expectedStatus: netHttp.StatusUnauthorized,
+		},
+		{
+			name:           "accepts valid basic auth",
+			endpoint:       EndpointPrometheus,
+			prepare:        func(r *netHttp.Request) { r.SetBasicAuth("prometheus", "secret") },
+			expectedStatus: netHttp.StatusOK,
+		},
+		{
+			name:           "rejects wrong password",
+			endpoint:       EndpointPrometheus,
+			prepare:        func(r *netHttp.Request) { r.SetBasicAuth("prometheus", "wrong") },
+			expectedStatus: netHttp.StatusUnauthorized,
+		},
+		{
+			name:           "rejects unknown user",
+			endpoint:       EndpointPrometheus,
+			prepare:        func(r *netHttp.Request) { r.SetBasicAuth("grafana", "secret") },
+			expectedStatus: netHttp.StatusUnauthorized,
+		},
+		{
+			name:           "accepts valid bearer token",
+			endpoint:       EndpointReload,
+			prepare:        func(r *netHttp.Request) { r.Header.Set("Authorization", "Bearer s3cr3t-token") },
+			expectedStatus: netHttp.StatusOK,
+		},
+		{
+			name:           "rejects wrong bearer token",
+			endpoint:       EndpointReload,
+			prepare:        func(r *netHttp.Request) { r.Header.Set("Authorization", "Bearer other") },
+			expectedStatus: netHttp.StatusUnauthorized,
+		},
+		{
+			name:           "leaves liveliness open by default",
+			endpoint:       EndpointLiveliness,
+			prepare:        func(r *netHttp.Request) {},
+			expectedStatus: netHttp.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(netHttp.MethodGet, "/", nil)
+			tt.prepare(request)
+			recorder := httptest.NewRecorder()
+
+			auth.protect(tt.endpoint, ok).ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == netHttp.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="mongodb_exporter"`, recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("protects the configured endpoints only", func(t *testing.T) {
+		auth, err := newAuthenticator(Auth{BearerTokenFiles: []string{tokenFile}, Endpoints: []string{EndpointLiveliness}})
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		auth.protect(EndpointLiveliness, ok).ServeHTTP(recorder, httptest.NewRequest(netHttp.MethodGet, "/", nil))
+		assert.Equal(t, netHttp.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+
+		recorder = httptest.NewRecorder()
+		auth.protect(EndpointPrometheus, ok).ServeHTTP(recorder, httptest.NewRequest(netHttp.MethodGet, "/", nil))
+		assert.Equal(t, netHttp.StatusOK, recorder.Code)
+	})
+
+	t.Run("fails on missing token file", func(t *testing.T) {
+		_, err := newAuthenticator(Auth{BearerTokenFiles: []string{filepath.Join(t.TempDir(), "missing")}})
+		assert.ErrorContains(t, err, "failed to read bearer token file")
+	})
+}
@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// BuiltinCollector collects built-in metrics from a single target
+type BuiltinCollector interface {
+	prometheus.Collector
+	UpdateConnection(con wrapper.IConnection)
+}
+
+// NewBuiltinCollectors creates the built-in collectors enabled in the config for the given target
+func NewBuiltinCollectors(c Config, t Target, con wrapper.IConnection, errorC chan error, metrics *Metrics) []BuiltinCollector {
+	collectors := make([]BuiltinCollector, 0)
+	if c.Builtin.ServerStatus {
+		collectors = append(collectors, NewServerStatusCollector(t, c.MongoDb.Timeout, con, errorC, metrics))
+	}
+	if c.Builtin.ReplSetStatus {
+		collectors = append(collectors, NewReplSetCollector(t, c.MongoDb.Timeout, con, errorC, metrics))
+	}
+	if c.Builtin.CollStats != nil {
+		collectors = append(collectors, NewCollStatsCollector(*c.Builtin.CollStats, t, c.MongoDb.Timeout, con, errorC, metrics))
+	}
+	if c.Builtin.IndexStats != nil {
+		collectors = append(collectors, NewIndexStatsCollector(*c.Builtin.IndexStats, t, c.MongoDb.Timeout, con, errorC, metrics))
+	}
+	if c.Builtin.CurrentOp != nil {
+		collectors = append(collectors, NewCurrentOpCollector(*c.Builtin.CurrentOp, t, c.MongoDb.Timeout, con, errorC, metrics))
+	}
+	return collectors
+}
+
+// statusMetric maps attributes of a command result to a metric
+type statusMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	// label is the variable label distinguishing the attributes; empty for a single attribute
+	label string
+	// attributes maps the label values to the attribute paths of the command result
+	attributes map[string]string
+}
+
+// commandRunner runs database commands of a built-in collector and keeps its connection
+// Failed commands are counted and logged. Only connection errors are sent to the error channel, which makes the
+// exporter reconnect; commands rejected by the server, e.g. replSetGetStatus on a standalone, fail on every collect.
+type commandRunner struct {
+	name    string
+	target  string
+	timeout time.Duration
+	mongo   wrapper.IConnection
+	errorC  chan error
+	metrics *Metrics
+	mu      sync.RWMutex
+}
+
+func newCommandRunner(name string, target string, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) *commandRunner {
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	return &commandRunner{
+		name:    name,
+		target:  target,
+		timeout: timeout,
+		mongo:   con,
+		errorC:  errorC,
+		metrics: metrics,
+	}
+}
+
+// UpdateConnection safely updates the MongoDB connection
+func (r *commandRunner) UpdateConnection(con wrapper.IConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mongo = con
+}
+
+// run executes the given command on the database and reports whether it succeeded
+func (r *commandRunner) run(db string, command driverbson.D) (bson.M, bool) {
+	results, ok := r.execute(db, "", "command", func(ctx context.Context, mongo wrapper.IConnection) ([]bson.M, error) {
+		result, err := runCommand(ctx, mongo, db, command, wrapper.QueryOptions{})
+		return []bson.M{result}, err
+	})
+	if !ok {
+		return nil, false
+	}
+	return results[0], true
+}
+
+// listCollectionNames lists the collections of the database matching the filter and reports whether it succeeded
+func (r *commandRunner) listCollectionNames(db string, filter driverbson.D) ([]string, bool) {
+	var names []string
+	_, ok := r.execute(db, "", "command", func(ctx context.Context, mongo wrapper.IConnection) ([]bson.M, error) {
+		var err error
+		names, err = mongo.ListCollectionNames(ctx, db, filter)
+		return nil, err
+	})
+	return names, ok
+}
+
+// aggregate runs the given pipeline on the collection and reports whether it succeeded
+func (r *commandRunner) aggregate(db string, collection string, pipeline driverbson.A) ([]bson.M, bool) {
+	return r.execute(db, collection, "aggregate", func(ctx context.Context, mongo wrapper.IConnection) ([]bson.M, error) {
+		cur, err := mongo.Aggregate(ctx, db, collection, pipeline, wrapper.QueryOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defer cur.Close(ctx)
+		var results []bson.M
+		for cur.Next(ctx) {
+			var result bson.M
+			if err := cur.Decode(&result); err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		return results, cur.Err()
+	})
+}
+
+// execute runs the given query with the current connection and tracks it in the internal metrics
+func (r *commandRunner) execute(db string, collection string, queryType string, query func(context.Context, wrapper.IConnection) ([]bson.M, error)) ([]bson.M, bool) {
+	r.mu.RLock()
+	mongo := r.mongo
+	r.mu.RUnlock()
+
+	if mongo == nil {
+		r.fail(db, collection, "no_connection", errNoConnection)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	r.metrics.ActiveQueries.WithLabelValues(r.target, db, collection).Inc()
+	defer r.metrics.ActiveQueries.WithLabelValues(r.target, db, collection).Dec()
+	timer := prometheus.NewTimer(r.metrics.QueryDuration.WithLabelValues(r.target, r.name, db, collection, queryType))
+	defer timer.ObserveDuration()
+
+	results, err := query(ctx, mongo)
+	if err != nil {
+		r.fail(db, collection, queryErrorType(err, queryType+"_failed"), fmt.Errorf("%s failed: %w", r.name, err))
+		return nil, false
+	}
+	r.metrics.LastSuccess.WithLabelValues(r.target, r.name).SetToCurrentTime()
+	return results, true
+}
+
+func (r *commandRunner) fail(db string, collection string, errorType string, err error) {
+	r.metrics.QueryErrors.WithLabelValues(r.target, r.name, db, collection, errorType).Inc()
+	log.Error(fmt.Sprintf(collectErrorMsg, err))
+	if !isConnectionError(err) {
+		return
+	}
+	select {
+	case r.errorC <- err:
+	default:
+		// Channel full, drop error to prevent blocking
+	}
+}
+
+// commandCollector runs a database command on every collect and exports attributes of its result
+// Missing attributes are skipped, since the result differs between server versions and topologies
+type commandCollector struct {
+	*commandRunner
+	db       string
+	command  driverbson.D
+	statuses []statusMetric
+	descs    []*prometheus.Desc
+}
+
+func newCommandCollector(name string, db string, command driverbson.D, statuses []statusMetric, t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) *commandCollector {
+	descs := make([]*prometheus.Desc, 0, len(statuses))
+	for _, s := range statuses {
+		var labels []string
+		if s.label != "" {
+			labels = []string{s.label}
+		}
+		descs = append(descs, prometheus.NewDesc(s.name, s.help, labels, t.ConstLabels()))
+	}
+	return &commandCollector{
+		commandRunner: newCommandRunner(name, t.Name, timeout, con, errorC, metrics),
+		db:            db,
+		command:       command,
+		statuses:      statuses,
+		descs:         descs,
+	}
+}
+
+// Describe writes the descriptors of all exported attributes
+func (c *commandCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect runs the command and exports all attributes found in its result
+func (c *commandCollector) Collect(ch chan<- prometheus.Metric) {
+	result, ok := c.run(c.db, c.command)
+	if !ok {
+		return
+	}
+	for i, s := range c.statuses {
+		for labelValue, attribute := range s.attributes {
+			value, err := extractNumber(result, attribute, c.name)
+			if err != nil {
+				continue
+			}
+			var labelValues []string
+			if s.label != "" {
+				labelValues = []string{labelValue}
+			}
+			ch <- prometheus.MustNewConstMetric(c.descs[i], s.valueType, value, labelValues...)
+		}
+	}
+}
+
+// runCommand executes the database command and decodes its result document
+func runCommand(ctx context.Context, con wrapper.IConnection, db string, command driverbson.D, opts wrapper.QueryOptions) (bson.M, error) {
+	res, err := con.RunCommand(ctx, db, command, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	var result bson.M
+	if err := res.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
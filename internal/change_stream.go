@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// changeStreamOperationLabel labels the events of change stream metrics by their operation type
+const changeStreamOperationLabel = "operation_type"
+
+// changeStreamRetryInterval is waited for before a failed change stream is reopened, unless the connection is updated earlier
+const changeStreamRetryInterval = 5 * time.Second
+
+// resumeTokenSaveInterval limits how often the resume token of a busy change stream is written to its file
+const resumeTokenSaveInterval = time.Second
+
+// eventCount counts the change events of one label combination
+type eventCount struct {
+	labels []string
+	count  float64
+}
+
+// errConnectionReplaced ends a change stream whose connection was replaced and disconnected by the exporter
+var errConnectionReplaced = errors.New("connection replaced")
+
+// Watch consumes the change stream of the metric until the context is done
+// A stream failed by a connection error is reported on the error channel, which lets the exporter reconnect, and is
+// reopened with the updated connection. Other failures, e.g. of a standalone server without change streams, and
+// invalidated streams are reopened after changeStreamRetryInterval. The stream resumes after the last counted event,
+// which is read from the resume token file on start.
+func (col *Collector) Watch(ctx context.Context) {
+	col.loadResumeToken()
+	for {
+		err := col.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errConnectionReplaced) {
+			continue
+		}
+		col.sendError(err)
+
+		// Only a reconnect may fix a connection error earlier
+		var connC chan struct{}
+		if isConnectionError(err) {
+			connC = col.connC
+		}
+		select {
+		case <-connC:
+		case <-time.After(changeStreamRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// consume opens the change stream and counts its events until it fails
+func (col *Collector) consume(ctx context.Context) error {
+	col.mu.RLock()
+	mongo := col.mongo
+	resumeToken := col.resumeToken
+	col.mu.RUnlock()
+
+	if mongo == nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "no_connection").Inc()
+		return errNoConnection
+	}
+
+	// Placeholders are evaluated whenever the stream is opened
+	query, err := col.prepareQuery()
+	if err != nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "invalid_query").Inc()
+		return fmt.Errorf("invalid query: %w", err)
+	}
+	stream, err := mongo.Watch(ctx, col.config.Db, col.config.Collection, query.pipeline, resumeToken, col.options)
+	if err != nil {
+		return col.streamFailed(err)
+	}
+	// The context may already be done
+	defer stream.Close(context.Background())
+	defer col.saveResumeToken()
+	log.Info("Watching change stream: " + col.String())
+
+	lastSave := time.Now()
+	for stream.Next(ctx) {
+		var event bson.M
+		if err := stream.Decode(&event); err != nil {
+			col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "decode_failed").Inc()
+			return fmt.Errorf("decode failed: %w", err)
+		}
+		operationType, _ := event["operationType"].(string)
+		// An invalidated stream, e.g. of a dropped collection, can only be continued with startAfter
+		col.countEvent(event, operationType, wrapper.ResumeToken{Token: stream.ResumeToken(), StartAfter: operationType == "invalidate"})
+
+		if operationType == "invalidate" {
+			col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "change_stream_invalidated").Inc()
+			return fmt.Errorf("change stream invalidated")
+		}
+		if time.Since(lastSave) >= resumeTokenSaveInterval {
+			col.saveResumeToken()
+			lastSave = time.Now()
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if col.connection() != mongo {
+		// The replaced connection was disconnected, which is no failure of the stream
+		return errConnectionReplaced
+	}
+	if err := stream.Err(); err != nil {
+		return col.streamFailed(err)
+	}
+	return col.streamFailed(fmt.Errorf("change stream closed"))
+}
+
+// streamFailed counts the failure and forgets the resume token if the stream cannot be resumed with it
+func (col *Collector) streamFailed(err error) error {
+	if isResumeTokenLost(err) {
+		col.setResumeToken(wrapper.ResumeToken{})
+		col.saveResumeToken()
+	}
+	col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, queryErrorType(err, "change_stream_failed")).Inc()
+	return fmt.Errorf("change stream failed: %w", err)
+}
+
+func (col *Collector) setResumeToken(token wrapper.ResumeToken) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	col.resumeToken = token
+}
+
+// savedResumeToken is the content of a resume token file
+type savedResumeToken struct {
+	Token      []byte `bson:"token"`
+	StartAfter bool   `bson:"startAfter"`
+}
+
+// loadResumeToken reads the resume token saved by a previous run, if a resume token file is configured
+// An unreadable file is logged and ignored, so that the stream starts at the current time.
+func (col *Collector) loadResumeToken() {
+	if col.config.ResumeTokenFile == "" {
+		return
+	}
+	data, err := os.ReadFile(col.config.ResumeTokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var saved savedResumeToken
+	if err == nil {
+		err = driverbson.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("Ignoring resume token file %s: %v", col.config.ResumeTokenFile, err))
+		return
+	}
+	col.setResumeToken(wrapper.ResumeToken{Token: driverbson.Raw(saved.Token), StartAfter: saved.StartAfter})
+}
+
+// saveResumeToken writes the current resume token to the resume token file, if configured
+// The file is replaced atomically and removed if the token was forgotten.
+func (col *Collector) saveResumeToken() {
+	file := col.config.ResumeTokenFile
+	if file == "" {
+		return
+	}
+	col.mu.RLock()
+	token := col.resumeToken
+	col.mu.RUnlock()
+
+	err := func() error {
+		if token.Token == nil {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+		data, err := driverbson.Marshal(savedResumeToken{Token: token.Token, StartAfter: token.StartAfter})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file+".tmp", data, 0o600); err != nil {
+			return err
+		}
+		return os.Rename(file+".tmp", file)
+	}()
+	if err != nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "resume_token_save_failed").Inc()
+		log.Error(fmt.Sprintf("Failed to save resume token to %s: %v", file, err))
+	}
+}
+
+// countEvent increments the counter of the event's labels and remembers the resume token of the event
+// Missing tag attributes are counted with an empty label value, since events differ by their operation type.
+func (col *Collector) countEvent(event bson.M, operationType string, resumeToken wrapper.ResumeToken) {
+	labels := make([]string, 0, len(col.varTagValueNames)+1)
+	labels = append(labels, operationType)
+	for _, attribute := range col.varTagValueNames {
+		value := ""
+		if v, err := lookupPath(event, attribute); err == nil {
+			value, _ = formatTagValue(v)
+		}
+		labels = append(labels, value)
+	}
+	key := strings.Join(labels, "\xff")
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	count, exists := col.events[key]
+	if !exists {
+		count = &eventCount{labels: labels}
+		col.events[key] = count
+	}
+	count.count++
+	col.resumeToken = resumeToken
+	col.lastSuccess = time.Now()
+	col.metrics.LastSuccess.WithLabelValues(col.target, col.config.Name).SetToCurrentTime()
+}
+
+// collectEvents serves the counted events
+func (col *Collector) collectEvents(ch chan<- prometheus.Metric) {
+	col.mu.RLock()
+	defer col.mu.RUnlock()
+	for _, count := range col.events {
+		ch <- prometheus.MustNewConstMetric(col.desc, prometheus.CounterValue, count.count, count.labels...)
+	}
+}
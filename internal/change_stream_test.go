@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func changeStreamMetric() Metric {
+	return Metric{
+		Name:          "orders_changes_total",
+		Help:          "Changes of orders",
+		Db:            "shop",
+		Collection:    "orders",
+		ChangeStream:  `[{"$match": {"operationType": {"$in": ["insert", "delete", "invalidate"]}}}]`,
+		TagAttributes: map[string]string{"region": "fullDocument.region"},
+	}
+}
+
+// changeStreamMock returns a stream of the given events, which ends with the given error
+// The resume token of every event is its index.
+func changeStreamMock(err error, events ...bson.M) *mocks.IChangeStream {
+	stream := &mocks.IChangeStream{}
+	for i, event := range events {
+		e := event
+		stream.On("Next", mock.Anything).Return(true).Once()
+		stream.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*bson.M) = e
+		}).Once()
+		stream.On("ResumeToken").Return(driverbson.Raw{byte(i)}).Once()
+	}
+	stream.On("Next", mock.Anything).Return(false)
+	stream.On("Err").Return(err)
+	stream.On("Close", mock.Anything).Return(nil)
+	return stream
+}
+
+func TestChangeStream(t *testing.T) {
+	t.Run("counts the events by operation type and tag attributes", func(t *testing.T) {
+		metric := changeStreamMetric()
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(changeStreamMock(assert.AnError,
+			bson.M{"operationType": "insert", "fullDocument": bson.M{"region": "eu"}},
+			bson.M{"operationType": "insert", "fullDocument": bson.M{"region": "eu"}},
+			bson.M{"operationType": "insert", "fullDocument": bson.M{"region": "us"}},
+			bson.M{"operationType": "delete"},
+		), nil)
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+
+		err := c.consume(context.Background())
+
+		assert.ErrorIs(t, err, assert.AnError)
+		expected := `
+# HELP orders_changes_total Changes of orders
+# TYPE orders_changes_total counter
+orders_changes_total{operation_type="delete",region=""} 1
+orders_changes_total{operation_type="insert",region="eu"} 2
+orders_changes_total{operation_type="insert",region="us"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("resumes after the last counted event", func(t *testing.T) {
+		metric := changeStreamMetric()
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(changeStreamMock(assert.AnError,
+			bson.M{"operationType": "insert"}, bson.M{"operationType": "insert"},
+		), nil).Once()
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+		_ = c.consume(context.Background())
+
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), wrapper.ResumeToken{Token: driverbson.Raw{1}}, mock.Anything).Return(changeStreamMock(assert.AnError), nil).Once()
+		_ = c.consume(context.Background())
+
+		con.AssertExpectations(t)
+	})
+
+	t.Run("starts after the invalidate event of an invalidated stream", func(t *testing.T) {
+		metric := changeStreamMetric()
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(changeStreamMock(nil,
+			bson.M{"operationType": "insert"}, bson.M{"operationType": "invalidate"},
+		), nil)
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+
+		err := c.consume(context.Background())
+
+		assert.ErrorContains(t, err, "invalidated")
+		assert.Equal(t, wrapper.ResumeToken{Token: driverbson.Raw{1}, StartAfter: true}, c.resumeToken)
+	})
+
+	t.Run("forgets the resume token if the history is lost", func(t *testing.T) {
+		metric := changeStreamMetric()
+		historyLost := mongo.CommandError{Code: changeStreamHistoryLostCode, Name: "ChangeStreamHistoryLost"}
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(nil, historyLost)
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+		c.resumeToken = wrapper.ResumeToken{Token: driverbson.Raw{1}}
+
+		err := c.consume(context.Background())
+
+		assert.ErrorContains(t, err, "ChangeStreamHistoryLost")
+		assert.Equal(t, wrapper.ResumeToken{}, c.resumeToken)
+	})
+
+	t.Run("reports failed streams until the context is done", func(t *testing.T) {
+		metric := changeStreamMetric()
+		ctx, cancel := context.WithCancel(context.Background())
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+		errorC := make(chan error, 1)
+		c := NewCollector(metric, con, errorC, testMetrics())
+
+		done := make(chan struct{})
+		go func() {
+			c.Watch(ctx)
+			close(done)
+		}()
+
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+		cancel()
+		<-done
+	})
+
+	t.Run("retries server side failures after the retry interval only", func(t *testing.T) {
+		metric := changeStreamMetric()
+		ctx, cancel := context.WithCancel(context.Background())
+		con := &mocks.IConnection{}
+		watched := make(chan struct{}, 10)
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).
+			Return(nil, mongo.CommandError{Code: 13, Name: "Unauthorized"}).Run(func(mock.Arguments) { watched <- struct{}{} })
+		errorC := make(chan error, 1)
+		c := NewCollector(metric, con, errorC, testMetrics())
+
+		done := make(chan struct{})
+		go func() {
+			c.Watch(ctx)
+			close(done)
+		}()
+		<-watched
+		// A reconnect triggered by another collector does not reopen the stream
+		c.UpdateConnection(con)
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Empty(t, errorC)
+		assert.Empty(t, watched)
+		cancel()
+		<-done
+	})
+
+	t.Run("saves the resume token to the resume token file", func(t *testing.T) {
+		metric := changeStreamMetric()
+		metric.ResumeTokenFile = filepath.Join(t.TempDir(), "orders.token")
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(changeStreamMock(assert.AnError,
+			bson.M{"operationType": "insert"}, bson.M{"operationType": "invalidate"},
+		), nil).Once()
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+		_ = c.consume(context.Background())
+
+		restarted := NewCollector(metric, con, make(chan error, 1), testMetrics())
+		restarted.loadResumeToken()
+
+		assert.Equal(t, wrapper.ResumeToken{Token: driverbson.Raw{1}, StartAfter: true}, restarted.resumeToken)
+	})
+
+	t.Run("removes the resume token file if the history is lost", func(t *testing.T) {
+		metric := changeStreamMetric()
+		metric.ResumeTokenFile = filepath.Join(t.TempDir(), "orders.token")
+		historyLost := mongo.CommandError{Code: changeStreamHistoryLostCode, Name: "ChangeStreamHistoryLost"}
+		con := &mocks.IConnection{}
+		con.On("Watch", mock.Anything, "shop", "orders", mustParsePipeline(metric.ChangeStream), mock.Anything, mock.Anything).Return(nil, historyLost)
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+		c.resumeToken = wrapper.ResumeToken{Token: driverbson.Raw{1}}
+		c.saveResumeToken()
+		assert.FileExists(t, metric.ResumeTokenFile)
+
+		_ = c.consume(context.Background())
+
+		assert.NoFileExists(t, metric.ResumeTokenFile)
+	})
+
+	t.Run("ignores an unreadable resume token file", func(t *testing.T) {
+		metric := changeStreamMetric()
+		metric.ResumeTokenFile = filepath.Join(t.TempDir(), "orders.token")
+		assert.NoError(t, os.WriteFile(metric.ResumeTokenFile, []byte("invalid"), 0o600))
+		c := NewCollector(metric, &mocks.IConnection{}, make(chan error, 1), testMetrics())
+
+		c.loadResumeToken()
+
+		assert.Equal(t, wrapper.ResumeToken{}, c.resumeToken)
+	})
+}
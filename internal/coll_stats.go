@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var collStatsPipeline = mustParsePipeline(`[{"$collStats": {"storageStats": {}}}]`)
+
+// collStatsMetric defines the metrics exported for every collection
+// The values refer to the attributes of the documents built by collStatsResults.
+var collStatsMetric = Metric{
+	Name: "mongodb_collection",
+	TagAttributes: map[string]string{
+		"db":         "db",
+		"collection": "collection",
+	},
+	Values: []MetricValue{
+		{Attribute: "count", Name: "mongodb_collection_documents", Help: "Number of documents in the collection"},
+		{Attribute: "size", Name: "mongodb_collection_size_bytes", Help: "Uncompressed size of all documents in the collection in bytes"},
+		{Attribute: "storageSize", Name: "mongodb_collection_storage_size_bytes", Help: "Storage size allocated to the collection in bytes"},
+		{Attribute: "totalIndexSize", Name: "mongodb_collection_index_size_bytes", Help: "Total size of all indexes of the collection in bytes"},
+		{Attribute: "avgObjSize", Name: "mongodb_collection_avg_object_size_bytes", Help: "Average size of the documents in the collection in bytes"},
+	},
+}
+
+// collStatsAttributes are summed up over the results of all shards
+var collStatsAttributes = []string{"count", "size", "storageSize", "totalIndexSize"}
+
+// NewCollStatsCollector creates a collector exporting document count, sizes and index size of the selected collections
+// of the given target
+func NewCollStatsCollector(c Discovery, t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) BuiltinCollector {
+	return newDiscoveredCollector("collStats", c, collStatsMetric, collStatsPipeline, collStatsResults, t, timeout, con, errorC, metrics)
+}
+
+// collStatsResults sums up the storage stats of all shards of the collection
+func collStatsResults(ns namespace, stats []bson.M) []bson.M {
+	result := bson.M{"db": ns.db, "collection": ns.collection}
+	for _, attribute := range collStatsAttributes {
+		sum := 0.0
+		for _, s := range stats {
+			if value, err := extractNumber(s, "storageStats."+attribute, "collStats"); err == nil {
+				sum += value
+			}
+		}
+		result[attribute] = sum
+	}
+	result["avgObjSize"] = 0.0
+	if count := result["count"].(float64); count > 0 {
+		result["avgObjSize"] = result["size"].(float64) / count
+	}
+	return []bson.M{result}
+}
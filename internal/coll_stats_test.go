@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// onAggregate lets the connection mock return the given documents for the pipeline on the collection
+func onAggregate(con *mocks.IConnection, db string, collection string, pipeline driverbson.A, docs ...bson.M) {
+	cursor := &mocks.ICursor{}
+	for _, doc := range docs {
+		d := doc
+		cursor.On("Next", mock.Anything).Return(true).Once()
+		cursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*bson.M) = d
+		}).Once()
+	}
+	cursor.On("Next", mock.Anything).Return(false)
+	cursor.On("Err").Return(nil)
+	cursor.On("Close", mock.Anything).Return(nil)
+	con.On("Aggregate", mock.Anything, db, collection, pipeline, mock.Anything).Return(cursor, nil)
+}
+
+func storageStats(count int64, size int64, storageSize int64, indexSize int64) bson.M {
+	return bson.M{"storageStats": bson.M{"count": count, "size": size, "storageSize": storageSize, "totalIndexSize": indexSize}}
+}
+
+func collStatsMock() *mocks.IConnection {
+	con := &mocks.IConnection{}
+	onCommand(con, "admin", listDatabasesCommand, bson.M{"databases": primitive.A{
+		bson.M{"name": "admin"}, bson.M{"name": "local"}, bson.M{"name": "shop"}, bson.M{"name": "logs"},
+	}})
+	con.On("ListCollectionNames", mock.Anything, "shop", listCollectionsFilter).Return([]string{"orders", "customers", "system.views"}, nil)
+	con.On("ListCollectionNames", mock.Anything, "logs", listCollectionsFilter).Return([]string{"events"}, nil)
+	onAggregate(con, "shop", "orders", collStatsPipeline, storageStats(10, 1000, 4096, 2048))
+	onAggregate(con, "shop", "customers", collStatsPipeline, storageStats(0, 0, 4096, 4096))
+	onAggregate(con, "logs", "events", collStatsPipeline, storageStats(3, 30, 100, 10), storageStats(1, 10, 100, 10))
+	return con
+}
+
+func TestCollStatsCollector(t *testing.T) {
+	t.Run("exports the stats of all discovered collections", func(t *testing.T) {
+		c := NewCollStatsCollector(Discovery{}, Target{}, 0, collStatsMock(), make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_collection_avg_object_size_bytes Average size of the documents in the collection in bytes
+# TYPE mongodb_collection_avg_object_size_bytes gauge
+mongodb_collection_avg_object_size_bytes{collection="customers",db="shop"} 0
+mongodb_collection_avg_object_size_bytes{collection="events",db="logs"} 10
+mongodb_collection_avg_object_size_bytes{collection="orders",db="shop"} 100
+# HELP mongodb_collection_documents Number of documents in the collection
+# TYPE mongodb_collection_documents gauge
+mongodb_collection_documents{collection="customers",db="shop"} 0
+mongodb_collection_documents{collection="events",db="logs"} 4
+mongodb_collection_documents{collection="orders",db="shop"} 10
+# HELP mongodb_collection_index_size_bytes Total size of all indexes of the collection in bytes
+# TYPE mongodb_collection_index_size_bytes gauge
+mongodb_collection_index_size_bytes{collection="customers",db="shop"} 4096
+mongodb_collection_index_size_bytes{collection="events",db="logs"} 20
+mongodb_collection_index_size_bytes{collection="orders",db="shop"} 2048
+`
+		err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+			"mongodb_collection_avg_object_size_bytes", "mongodb_collection_documents", "mongodb_collection_index_size_bytes")
+		assert.NoError(t, err)
+	})
+
+	t.Run("filters the collections by namespace", func(t *testing.T) {
+		config := Discovery{Include: `^shop\.`, Exclude: `\.customers$`}
+		c := NewCollStatsCollector(config, Target{}, 0, collStatsMock(), make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_collection_documents Number of documents in the collection
+# TYPE mongodb_collection_documents gauge
+mongodb_collection_documents{collection="orders",db="shop"} 10
+`
+		err := testutil.CollectAndCompare(c, strings.NewReader(expected), "mongodb_collection_documents")
+		assert.NoError(t, err)
+	})
+
+	t.Run("discovers the collections once per refresh interval", func(t *testing.T) {
+		con := collStatsMock()
+		c := NewCollStatsCollector(Discovery{}, Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		assert.Equal(t, 15, testutil.CollectAndCount(c))
+		assert.Equal(t, 15, testutil.CollectAndCount(c))
+		con.AssertNumberOfCalls(t, "RunCommand", 1)
+		con.AssertNumberOfCalls(t, "ListCollectionNames", 2)
+		con.AssertNumberOfCalls(t, "Aggregate", 6)
+	})
+
+	t.Run("reports discoveries failed by the connection", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		con.On("RunCommand", mock.Anything, "admin", listDatabasesCommand, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+		errorC := make(chan error, 1)
+
+		c := NewCollStatsCollector(Discovery{}, Target{}, 0, con, errorC, testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+	})
+}
@@ -2,8 +2,10 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ppussar/mongodb_exporter/internal/logger"
@@ -15,36 +17,135 @@ import (
 // Collector queries one prometheus metric from mongoDB
 type Collector struct {
 	desc             *prometheus.Desc
+	values           []valueDesc
+	resultAge        *prometheus.Desc
 	config           Metric
+	target           string
+	template         *queryTemplate
+	parsed           *parsedQuery
+	options          wrapper.QueryOptions
+	queryErr         error
 	mongo            wrapper.IConnection
 	varTagValueNames []string
 	errorC           chan error
-	mu               sync.RWMutex
+	metrics          *Metrics
+	cache            []prometheus.Metric
+	created          time.Time
+	lastSuccess      time.Time
+	events           map[string]*eventCount
+	resumeToken      wrapper.ResumeToken
+	connC            chan struct{}
+	// failures counts all failed collections, including those which are not sent to the error channel
+	failures atomic.Int64
+	mu       sync.RWMutex
 }
 
 var log = logger.GetInstance()
 var collectErrorMsg = "Error during collect: %v"
 
+// defaultQueryTimeout is used for metrics without a configured timeout
+const defaultQueryTimeout = 10 * time.Second
+
+// resultAgeName is the metric exported for the cached result of each scheduled metric
+const resultAgeName = "mongodb_exporter_result_age_seconds"
+
+// valueDesc describes one value which is exported for every result document
+type valueDesc struct {
+	desc      *prometheus.Desc
+	attribute string
+	valueType prometheus.ValueType
+}
+
 // NewCollector constructor
 // initializes every descriptor and returns a pointer to the collector
-func NewCollector(m Metric, con wrapper.IConnection, errorC chan error) *Collector {
+func NewCollector(m Metric, con wrapper.IConnection, errorC chan error, metrics *Metrics) *Collector {
 	varTagNames := make([]string, 0, len(m.TagAttributes))
 	varTagValues := make([]string, 0, len(m.TagAttributes))
 	for key, value := range m.TagAttributes {
 		varTagNames = append(varTagNames, key)
 		varTagValues = append(varTagValues, value)
 	}
+	desc := prometheus.NewDesc(
+		m.Name,
+		m.Help,
+		varTagNames,
+		m.Tags,
+	)
+
+	values := []valueDesc{{desc: desc, attribute: m.MetricsAttribute, valueType: valueTypeOf(m.Type)}}
+	if m.ChangeStream != "" {
+		// Events are counted by their operation type in addition to the tag attributes
+		desc = prometheus.NewDesc(m.Name, m.Help, append([]string{changeStreamOperationLabel}, varTagNames...), m.Tags)
+		values = []valueDesc{{desc: desc, valueType: prometheus.CounterValue}}
+	} else if len(m.Values) > 0 {
+		values = make([]valueDesc, 0, len(m.Values))
+		for _, v := range m.Values {
+			help := v.Help
+			if help == "" {
+				help = m.Help
+			}
+			valueType := v.Type
+			if valueType == "" {
+				valueType = m.Type
+			}
+			values = append(values, valueDesc{
+				desc:      prometheus.NewDesc(v.MetricName(m.Name), help, varTagNames, m.Tags),
+				attribute: v.Attribute,
+				valueType: valueTypeOf(valueType),
+			})
+		}
+	}
+
+	// Queries are validated with the config, a broken one fails each collection
+	// Queries without placeholders are parsed once, templates before each collection
+	var parsed *parsedQuery
+	template, queryErr := parseQueryTemplate(m.Name, m.Query(), m.Vars)
+	if queryErr == nil && !template.hasPlaceholders() {
+		var q parsedQuery
+		q, queryErr = parseQuery(m, m.Query())
+		parsed = &q
+	}
+	opts, err := queryOptions(m)
+	if queryErr == nil {
+		queryErr = err
+	}
+
+	// The age is exported with the tags of the metric, which distinguish metrics of the same name
+	ageLabels := prometheus.Labels{TargetLabel: "", "metric_name": m.Name}
+	for key, value := range m.Tags {
+		ageLabels[key] = value
+	}
+
 	return &Collector{
-		desc: prometheus.NewDesc(
-			m.Name,
-			m.Help,
-			varTagNames,
-			m.Tags,
-		),
+		desc:             desc,
+		values:           values,
+		resultAge:        prometheus.NewDesc(resultAgeName, "Age of the cached query result served for scheduled metrics in seconds", nil, ageLabels),
 		config:           m,
+		target:           m.Tags[TargetLabel],
+		template:         template,
+		parsed:           parsed,
+		options:          opts,
+		queryErr:         queryErr,
 		mongo:            con,
 		varTagValueNames: varTagValues,
 		errorC:           errorC,
+		metrics:          metrics,
+		events:           make(map[string]*eventCount),
+		connC:            make(chan struct{}, 1),
+		created:          time.Now(),
+	}
+}
+
+// valueTypeOf maps the configured metric type to the prometheus value type
+// Info metrics are exposed as gauges with the constant value 1
+func valueTypeOf(metricType string) prometheus.ValueType {
+	switch metricType {
+	case MetricTypeCounter:
+		return prometheus.CounterValue
+	case MetricTypeUntyped:
+		return prometheus.UntypedValue
+	default:
+		return prometheus.GaugeValue
 	}
 }
 
@@ -53,113 +154,262 @@ func (col *Collector) UpdateConnection(con wrapper.IConnection) {
 	col.mu.Lock()
 	defer col.mu.Unlock()
 	col.mongo = con
+	// Wake up a failed change stream
+	select {
+	case col.connC <- struct{}{}:
+	default:
+	}
+}
+
+// connection returns the current MongoDB connection
+func (col *Collector) connection() wrapper.IConnection {
+	col.mu.RLock()
+	defer col.mu.RUnlock()
+	return col.mongo
 }
 
 // Describe must be implemented by a prometheus collector
 // It essentially writes all descriptors to the prometheus desc channel.
 func (col *Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- col.desc
+	for _, v := range col.values {
+		ch <- v.desc
+	}
+	if col.config.Interval > 0 && col.config.ChangeStream == "" {
+		ch <- col.resultAge
+	}
 }
 
 // Collect implements required collect function for all prometheus collectors
+// Scheduled collectors serve the result of the last successful Refresh instead of querying mongoDB,
+// change stream collectors serve the counted events
 func (col *Collector) Collect(ch chan<- prometheus.Metric) {
+	if col.config.ChangeStream != "" {
+		col.collectEvents(ch)
+		return
+	}
+	if col.config.Interval > 0 {
+		col.collectCached(ch)
+		return
+	}
+
+	metrics, ok := col.query()
+	if !ok {
+		return
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// Refresh queries mongoDB and caches the result, which is served by Collect of scheduled collectors
+// On failure the last successful result is kept
+func (col *Collector) Refresh() {
+	metrics, ok := col.query()
+	if !ok {
+		return
+	}
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	col.cache = metrics
+	col.lastSuccess = time.Now()
+}
+
+// collectCached serves the cached result together with its age
+// Before the first successful Refresh, the age is counted from the creation of the collector.
+func (col *Collector) collectCached(ch chan<- prometheus.Metric) {
+	col.mu.RLock()
+	metrics := col.cache
+	lastSuccess := col.lastSuccess
+	col.mu.RUnlock()
+
+	if lastSuccess.IsZero() {
+		lastSuccess = col.created
+	}
+	ch <- prometheus.MustNewConstMetric(col.resultAge, prometheus.GaugeValue, time.Since(lastSuccess).Seconds())
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// prepareQuery returns the parsed query, evaluating the placeholders of a templated query
+func (col *Collector) prepareQuery() (parsedQuery, error) {
+	if col.queryErr != nil {
+		return parsedQuery{}, col.queryErr
+	}
+	if col.parsed != nil {
+		return *col.parsed, nil
+	}
+	query, err := col.template.render(time.Now())
+	if err != nil {
+		return parsedQuery{}, err
+	}
+	return parseQuery(col.config, query)
+}
+
+// query executes the configured query and converts its result into prometheus metrics
+// Errors are counted, logged and sent to the error channel; ok is false in this case
+func (col *Collector) query() ([]prometheus.Metric, bool) {
 	col.mu.RLock()
 	mongo := col.mongo
 	col.mu.RUnlock()
 	
 	if mongo == nil {
-		QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "no_connection").Inc()
-		col.sendError(fmt.Errorf("no MongoDB connection available"))
-		return
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "no_connection").Inc()
+		col.sendError(errNoConnection)
+		return nil, false
+	}
+
+	query, err := col.prepareQuery()
+	if err != nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "invalid_query").Inc()
+		col.sendError(fmt.Errorf("invalid query: %w", err))
+		return nil, false
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), col.timeout())
 	defer cancel()
+	opts := col.options
+	opts.MaxTime = col.maxTime()
 
 	var cur wrapper.ICursor
-	var err error
+	var results []bson.M
 	var queryType string
 	
 	// Track active query
-	ActiveQueries.WithLabelValues(col.config.Db, col.config.Collection).Inc()
-	defer ActiveQueries.WithLabelValues(col.config.Db, col.config.Collection).Dec()
+	col.metrics.ActiveQueries.WithLabelValues(col.target, col.config.Db, col.config.Collection).Inc()
+	defer col.metrics.ActiveQueries.WithLabelValues(col.target, col.config.Db, col.config.Collection).Dec()
 	
 	// Start timing
-	timer := prometheus.NewTimer(QueryDuration.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, queryType))
+	timer := prometheus.NewTimer(col.metrics.QueryDuration.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, queryType))
 	defer timer.ObserveDuration()
 	
-	if len(col.config.Aggregate) != 0 {
+	if len(col.config.Command) != 0 {
+		// A command returns a single result document
+		queryType = "command"
+		var result bson.M
+		result, err = runCommand(ctx, mongo, col.config.Db, query.document, opts)
+		results = []bson.M{result}
+	} else if len(col.config.Aggregate) != 0 {
 		queryType = "aggregate"
-		cur, err = mongo.Aggregate(ctx, col.config.Db, col.config.Collection, col.config.Aggregate)
+		cur, err = mongo.Aggregate(ctx, col.config.Db, col.config.Collection, query.pipeline, opts)
 	} else if len(col.config.Find) != 0 {
 		queryType = "find"
-		cur, err = mongo.Find(ctx, col.config.Db, col.config.Collection, col.config.Find)
+		cur, err = mongo.Find(ctx, col.config.Db, col.config.Collection, query.document, opts)
 	} else {
-		QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "no_query").Inc()
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "no_query").Inc()
 		col.sendError(fmt.Errorf("no query configured for metric: %s", col.config.Name))
-		return
+		return nil, false
 	}
 	
 	// Update timer with correct query type
-	timer = prometheus.NewTimer(QueryDuration.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, queryType))
+	timer = prometheus.NewTimer(col.metrics.QueryDuration.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, queryType))
 	defer timer.ObserveDuration()
 	
 	if err != nil {
-		QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "query_failed").Inc()
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, queryErrorType(err, "query_failed")).Inc()
 		col.sendError(fmt.Errorf("query failed: %w", err))
-		return
+		return nil, false
 	}
 	
+	if cur != nil {
+		var ok bool
+		if results, ok = col.readCursor(ctx, cur); !ok {
+			return nil, false
+		}
+	}
+
+	metrics, errorType, err := col.buildMetrics(results)
+	if err != nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, errorType).Inc()
+		col.sendError(err)
+		return nil, false
+	}
+	
+	// Track successful collection
+	col.metrics.MetricsCollected.WithLabelValues(col.target, col.config.Name).Add(float64(len(metrics)))
+	col.metrics.LastSuccess.WithLabelValues(col.target, col.config.Name).SetToCurrentTime()
+	return metrics, true
+}
+
+// readCursor decodes all result documents of the cursor and closes it
+// Errors are counted, logged and sent to the error channel; ok is false in this case
+func (col *Collector) readCursor(ctx context.Context, cur wrapper.ICursor) ([]bson.M, bool) {
 	defer func() {
-		if cur != nil {
-			if err := cur.Close(ctx); err != nil {
-				QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "cursor_close_failed").Inc()
-				col.sendError(fmt.Errorf("cursor close failed: %w", err))
-			}
+		if err := cur.Close(ctx); err != nil {
+			col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "cursor_close_failed").Inc()
+			col.sendError(fmt.Errorf("cursor close failed: %w", err))
 		}
 	}()
 
-	metricsCount := 0
+	var results []bson.M
 	for cur.Next(ctx) {
 		var result bson.M
 		if err := cur.Decode(&result); err != nil {
-			QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "decode_failed").Inc()
+			col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, "decode_failed").Inc()
 			col.sendError(fmt.Errorf("decode failed: %w", err))
-			return
+			return nil, false
 		}
+		results = append(results, result)
+	}
 
-		floatVal, err := col.extractMetricValue(result)
-		if err != nil {
-			QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "extract_value_failed").Inc()
-			col.sendError(err)
-			return
+	if err := cur.Err(); err != nil {
+		col.metrics.QueryErrors.WithLabelValues(col.target, col.config.Name, col.config.Db, col.config.Collection, queryErrorType(err, "cursor_iteration_failed")).Inc()
+		col.sendError(fmt.Errorf("cursor iteration failed: %w", err))
+		return nil, false
+	}
+	return results, true
+}
+
+// buildMetrics converts the query results into prometheus metrics depending on the configured metric type
+// On failure the error_type label value for QueryErrors is returned together with the error
+func (col *Collector) buildMetrics(results []bson.M) ([]prometheus.Metric, string, error) {
+	switch col.config.Type {
+	case MetricTypeHistogram:
+		return col.buildHistograms(results)
+	case MetricTypeSummary:
+		return col.buildSummaries(results)
+	case MetricTypeInfo:
+		if len(col.varTagValueNames) == 0 && len(col.config.Values) == 0 {
+			return col.buildInfos(results)
 		}
+	}
 
+	metrics := make([]prometheus.Metric, 0, len(results)*len(col.values))
+	for _, result := range results {
 		tagValues, err := col.extractVarTagsValues(result)
 		if err != nil {
-			QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "extract_tags_failed").Inc()
-			col.sendError(err)
-			return
+			return nil, extractErrorType(err, "extract_tags_failed"), err
 		}
 
-		ch <- prometheus.MustNewConstMetric(col.desc, prometheus.GaugeValue, floatVal, tagValues...)
-		metricsCount++
-	}
-	
-	if err := cur.Err(); err != nil {
-		QueryErrors.WithLabelValues(col.config.Name, col.config.Db, col.config.Collection, "cursor_iteration_failed").Inc()
-		col.sendError(fmt.Errorf("cursor iteration failed: %w", err))
-		return
+		for _, v := range col.values {
+			floatVal, err := col.extractValue(result, v.attribute)
+			if err != nil {
+				return nil, extractErrorType(err, "extract_value_failed"), err
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(v.desc, v.valueType, floatVal, tagValues...))
+		}
 	}
-	
-	// Track successful collection
-	MetricsCollected.WithLabelValues(col.config.Name).Add(float64(metricsCount))
+	return metrics, "", nil
 }
 
 func (col *Collector) extractMetricValue(result bson.M) (float64, error) {
-	val, exists := result[col.config.MetricsAttribute]
-	if !exists {
-		return 0, fmt.Errorf("metric attribute '%s' not found in result", col.config.MetricsAttribute)
+	return col.extractValue(result, col.config.MetricsAttribute)
+}
+
+func (col *Collector) extractValue(result bson.M, attribute string) (float64, error) {
+	if col.config.Type == MetricTypeInfo {
+		return 1, nil
+	}
+
+	return extractNumber(result, attribute, "metric")
+}
+
+// extractNumber resolves the given attribute path and converts its value to float64
+// kind names the attribute in error messages, e.g. "metric" or "count"
+func extractNumber(result bson.M, attribute string, kind string) (float64, error) {
+	val, err := lookupPath(result, attribute)
+	if err != nil {
+		return 0, fmt.Errorf("%s attribute '%s' not found in result: %w", kind, attribute, err)
 	}
 
 	switch v := val.(type) {
@@ -172,32 +422,84 @@ func (col *Collector) extractMetricValue(result bson.M) (float64, error) {
 	case int:
 		return float64(v), nil
 	default:
-		return 0, fmt.Errorf("unsupported metric value type %T for %s", val, col.config.MetricsAttribute)
+		return 0, fmt.Errorf("unsupported %s value type %T for %s", kind, val, attribute)
 	}
 }
 
 func (col *Collector) extractVarTagsValues(result bson.M) ([]string, error) {
 	tagValues := make([]string, len(col.varTagValueNames))
 	for i, tagName := range col.varTagValueNames {
-		tagValue, exists := result[tagName]
-		if !exists {
-			return nil, fmt.Errorf("tag attribute '%s' not found in result", tagName)
+		tagValue, err := lookupPath(result, tagName)
+		if err != nil {
+			return nil, fmt.Errorf("tag attribute '%s' not found in result: %w", tagName, err)
 		}
-		
-		switch v := tagValue.(type) {
-		case string:
-			tagValues[i] = v
-		case int, int32, int64, float32, float64:
-			tagValues[i] = fmt.Sprintf("%v", v)
-		default:
+
+		value, ok := formatTagValue(tagValue)
+		if !ok {
 			return nil, fmt.Errorf("unsupported tag value type %T for %s", tagValue, tagName)
 		}
+		tagValues[i] = value
 	}
 	return tagValues, nil
 }
 
+// formatTagValue converts a scalar attribute value into a label value
+func formatTagValue(tagValue interface{}) (string, bool) {
+	switch v := tagValue.(type) {
+	case string:
+		return v, true
+	case int, int32, int64, float32, float64, bool:
+		return fmt.Sprintf("%v", v), true
+	default:
+		return "", false
+	}
+}
+
+// timeout returns the client side timeout of a single query
+func (col *Collector) timeout() time.Duration {
+	if col.config.Timeout > 0 {
+		return col.config.Timeout
+	}
+	return defaultQueryTimeout
+}
+
+// maxTime returns the server side execution time limit of a single query
+// Without an explicit maxTimeMS the server aborts the query as soon as the client gives up
+func (col *Collector) maxTime() time.Duration {
+	if col.config.MaxTimeMS > 0 {
+		return time.Duration(col.config.MaxTimeMS) * time.Millisecond
+	}
+	return col.timeout()
+}
+
+// queryErrorType returns the error_type label for a failed query, distinguishing timeouts from other failures
+func queryErrorType(err error, fallback string) string {
+	if isMaxTimeExpired(err) {
+		return "max_time_ms_expired"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return fallback
+}
+
+// extractErrorType returns the error_type label for a failed value or tag extraction
+func extractErrorType(err error, fallback string) string {
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		return string(pathErr.Kind)
+	}
+	return fallback
+}
+
+// sendError logs the error and reports connection errors to the exporter, which reconnects
+// Other errors, e.g. of a malformed query or missing privileges, would fail again with a new connection.
 func (col *Collector) sendError(err error) {
+	col.failures.Add(1)
 	log.Error(fmt.Sprintf(collectErrorMsg, err))
+	if !isConnectionError(err) {
+		return
+	}
 	select {
 	case col.errorC <- err:
 	default:
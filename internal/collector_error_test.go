@@ -1,11 +1,14 @@
 package internal
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestSendError(t *testing.T) {
@@ -45,7 +48,7 @@ func TestSendError(t *testing.T) {
 			// Send errors
 			start := time.Now()
 			for i := 0; i < tt.errorCount; i++ {
-				collector.sendError(assert.AnError)
+				collector.sendError(mongo.ErrClientDisconnected)
 			}
 			duration := time.Since(start)
 
@@ -68,12 +71,24 @@ func TestSendError(t *testing.T) {
 	}
 }
 
+func TestSendErrorIgnoresServerErrors(t *testing.T) {
+	errorC := make(chan error, 1)
+	collector := &Collector{errorC: errorC}
+
+	collector.sendError(fmt.Errorf("query failed: %w", mongo.CommandError{Code: 13, Name: "Unauthorized"}))
+	collector.sendError(&PathError{Kind: PathNotFound, Segment: "count", Reason: "not found"})
+
+	assert.Empty(t, errorC, "only connection errors require a reconnect")
+	assert.Equal(t, int64(2), collector.failures.Load())
+}
+
 func TestCollectorNilConnection(t *testing.T) {
 	errorC := make(chan error, 1)
 	collector := &Collector{
-		config: Metric{Name: "test_metric"},
-		mongo:  nil,
-		errorC: errorC,
+		config:  Metric{Name: "test_metric"},
+		mongo:   nil,
+		errorC:  errorC,
+		metrics: testMetrics(),
 	}
 
 	// Create a channel to collect metrics
@@ -99,3 +114,17 @@ func TestCollectorNilConnection(t *testing.T) {
 		// Expected
 	}
 }
+
+func TestCollectorErrorsPerTarget(t *testing.T) {
+	metrics := testMetrics()
+	m := Metric{Name: "test_metric", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count"}
+	eu := NewCollector(m.ForTarget(Target{Name: "eu"}), nil, make(chan error, 2), metrics)
+	us := NewCollector(m.ForTarget(Target{Name: "us"}), nil, make(chan error, 2), metrics)
+
+	eu.Collect(make(chan prometheus.Metric, 1))
+	eu.Collect(make(chan prometheus.Metric, 1))
+	us.Collect(make(chan prometheus.Metric, 1))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("eu", "test_metric", "db", "col", "no_connection")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("us", "test_metric", "db", "col", "no_connection")))
+}
@@ -139,3 +139,27 @@ func TestUpdateConnection(t *testing.T) {
 	assert.Nil(t, collector.mongo)
 	collector.mu.RUnlock()
 }
+
+func TestExtractNestedAttributes(t *testing.T) {
+	collector := &Collector{
+		config:           Metric{MetricsAttribute: "stats.count"},
+		varTagValueNames: []string{"_id.region", "items.0.sku"},
+	}
+	result := bson.M{
+		"_id":   bson.M{"region": "eu"},
+		"stats": bson.M{"count": int64(12)},
+		"items": []interface{}{bson.M{"sku": "A-1"}},
+	}
+
+	value, err := collector.extractMetricValue(result)
+	assert.NoError(t, err)
+	assert.Equal(t, 12.0, value)
+
+	tags, err := collector.extractVarTagsValues(result)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu", "A-1"}, tags)
+
+	_, err = collector.extractMetricValue(bson.M{"stats": "not a document"})
+	assert.Error(t, err)
+	assert.Equal(t, string(PathNotTraversable), extractErrorType(err, "extract_value_failed"))
+}
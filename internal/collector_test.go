@@ -1,13 +1,23 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"github.com/stretchr/testify/mock"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,7 +35,7 @@ func TestCollector(t *testing.T) {
 			},
 		}
 		con := Connection{}
-		c := NewCollector(metric, con, make(chan error, 1))
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
 
 		assert.Equal(t, "Desc{fqName: \"name\", help: \"help\", constLabels: {tagKey=\"tagValue\"}, variableLabels: {tagAttrKey}}", c.String())
 	})
@@ -38,7 +48,7 @@ func TestDescribe(t *testing.T) {
 			Help: "myHelp",
 		}
 		con := Connection{}
-		c := NewCollector(metric, con, make(chan error, 1))
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
 		ch := make(chan *prometheus.Desc, 1)
 		c.Describe(ch)
 
@@ -59,9 +69,9 @@ func TestCollect(t *testing.T) {
 		mongoCursor.On("Err").Return(nil).Once()
 		mongoCursor.On("Close", mock.Anything).Return(nil).Once()
 		mongoMock := mocks.IConnection{}
-		mongoMock.On("Aggregate", mock.Anything, metric.Db, metric.Collection, metric.Aggregate).Return(&mongoCursor, nil).Once()
+		mongoMock.On("Aggregate", mock.Anything, metric.Db, metric.Collection, mustParsePipeline(metric.Aggregate), mock.Anything).Return(&mongoCursor, nil).Once()
 
-		c := NewCollector(metric, &mongoMock, make(chan error, 1))
+		c := NewCollector(metric, &mongoMock, make(chan error, 1), testMetrics())
 		ch := make(chan prometheus.Metric, 1)
 		c.Collect(ch)
 
@@ -85,9 +95,9 @@ func TestCollect(t *testing.T) {
 
 		mongoCursor.On("Close", mock.Anything).Return(nil).Once()
 		mongoMock := mocks.IConnection{}
-		mongoMock.On("Aggregate", mock.Anything, metric.Db, metric.Collection, metric.Aggregate).Return(&mongoCursor, nil).Once()
+		mongoMock.On("Aggregate", mock.Anything, metric.Db, metric.Collection, mustParsePipeline(metric.Aggregate), mock.Anything).Return(&mongoCursor, nil).Once()
 
-		c := NewCollector(metric, &mongoMock, make(chan error, 1))
+		c := NewCollector(metric, &mongoMock, make(chan error, 1), testMetrics())
 		ch := make(chan prometheus.Metric, 1)
 		c.Collect(ch)
 
@@ -97,6 +107,72 @@ func TestCollect(t *testing.T) {
 		mongoMock.AssertExpectations(t)
 	})
 
+	t.Run("Collect with find: emits configured metric type", func(t *testing.T) {
+		tests := []struct {
+			metricType string
+			expected   string
+			value      float64
+		}{
+			{metricType: "", expected: "gauge", value: 42},
+			{metricType: MetricTypeCounter, expected: "counter", value: 42},
+			{metricType: MetricTypeUntyped, expected: "untyped", value: 42},
+			{metricType: MetricTypeInfo, expected: "gauge", value: 1},
+		}
+
+		for _, tt := range tests {
+			metric, doc := testMetric()
+			metric.Type = tt.metricType
+			metric.Find = "{}"
+			if tt.metricType == MetricTypeInfo {
+				metric.MetricsAttribute = ""
+			}
+
+			c := NewCollector(metric, findMock(metric, doc), make(chan error, 1), testMetrics())
+			ch := make(chan prometheus.Metric, 1)
+			c.Collect(ch)
+
+			assert.Equal(t, 1, len(ch))
+			out := &dto.Metric{}
+			assert.NoError(t, (<-ch).Write(out))
+			switch tt.expected {
+			case "counter":
+				assert.Equal(t, tt.value, out.GetCounter().GetValue())
+			case "untyped":
+				assert.Equal(t, tt.value, out.GetUntyped().GetValue())
+			default:
+				assert.Equal(t, tt.value, out.GetGauge().GetValue())
+			}
+		}
+	})
+
+	t.Run("Collect with find: emits all configured values", func(t *testing.T) {
+		metric, _ := testMetric()
+		metric.Find = "{}"
+		metric.MetricsAttribute = ""
+		metric.Values = []MetricValue{
+			{Attribute: "count", Suffix: "count", Type: MetricTypeCounter},
+			{Attribute: "stats.max", Name: "myMetricMax", Help: "maxHelp"},
+		}
+		doc := bson.M{"_id": "112233", "count": int32(3), "stats": bson.M{"max": 9.5}}
+
+		c := NewCollector(metric, findMock(metric, doc), make(chan error, 1), testMetrics())
+		descC := make(chan *prometheus.Desc, 2)
+		c.Describe(descC)
+		assert.Equal(t, `Desc{fqName: "myMetric_count", help: "myHelp", constLabels: {constTag="value"}, variableLabels: {dynTag}}`, (<-descC).String())
+		assert.Equal(t, `Desc{fqName: "myMetricMax", help: "maxHelp", constLabels: {constTag="value"}, variableLabels: {dynTag}}`, (<-descC).String())
+
+		ch := make(chan prometheus.Metric, 2)
+		c.Collect(ch)
+
+		assert.Equal(t, 2, len(ch))
+		count := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(count))
+		assert.Equal(t, 3.0, count.GetCounter().GetValue())
+		max := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(max))
+		assert.Equal(t, 9.5, max.GetGauge().GetValue())
+	})
+
 	t.Run("Collect with find: handle empty result", func(t *testing.T) {
 		metric, _ := testMetric()
 		metric.Find = "{}"
@@ -106,9 +182,9 @@ func TestCollect(t *testing.T) {
 		mongoCursor.On("Err").Return(nil).Once()
 		mongoCursor.On("Close", mock.Anything).Return(nil).Once()
 		mongoMock := mocks.IConnection{}
-		mongoMock.On("Find", mock.Anything, metric.Db, metric.Collection, metric.Find).Return(&mongoCursor, nil).Once()
+		mongoMock.On("Find", mock.Anything, metric.Db, metric.Collection, mustParseDocument(metric.Find), mock.Anything).Return(&mongoCursor, nil).Once()
 
-		c := NewCollector(metric, &mongoMock, make(chan error, 1))
+		c := NewCollector(metric, &mongoMock, make(chan error, 1), testMetrics())
 		ch := make(chan prometheus.Metric, 1)
 		c.Collect(ch)
 
@@ -117,6 +193,79 @@ func TestCollect(t *testing.T) {
 		mongoMock.AssertExpectations(t)
 	})
 
+	t.Run("Collect with command: handle result", func(t *testing.T) {
+		metric := Metric{
+			Name:             "myMetric",
+			Help:             "myHelp",
+			Db:               "myDB",
+			Command:          `{"dbStats": 1}`,
+			MetricsAttribute: "objects",
+			TagAttributes:    map[string]string{"db": "db"},
+		}
+		mongoMock := &mocks.IConnection{}
+		onCommand(mongoMock, metric.Db, mustParseDocument(metric.Command), bson.M{"db": "myDB", "objects": int64(42)})
+
+		c := NewCollector(metric, mongoMock, make(chan error, 1), testMetrics())
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+
+		out := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(out))
+		assert.Equal(t, 42.0, out.GetGauge().GetValue())
+		assert.Equal(t, "myDB", out.GetLabel()[0].GetValue())
+		mongoMock.AssertExpectations(t)
+	})
+
+	t.Run("Collect with command: handle failed command", func(t *testing.T) {
+		metric := Metric{Name: "myMetric", Db: "myDB", Command: `{"dbStats": 1}`, MetricsAttribute: "objects"}
+		mongoMock := &mocks.IConnection{}
+		mongoMock.On("RunCommand", mock.Anything, metric.Db, mustParseDocument(metric.Command), mock.Anything).Return(nil, mongo.ErrClientDisconnected).Once()
+		errorC := make(chan error, 1)
+
+		c := NewCollector(metric, mongoMock, errorC, testMetrics())
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+
+		assert.Equal(t, 0, len(ch))
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+	})
+
+	t.Run("Collect with command: count rejected command without reconnecting", func(t *testing.T) {
+		metric := Metric{Name: "myMetric", Db: "myDB", Command: `{"dbStats": 1}`, MetricsAttribute: "objects"}
+		mongoMock := &mocks.IConnection{}
+		mongoMock.On("RunCommand", mock.Anything, metric.Db, mustParseDocument(metric.Command), mock.Anything).Return(nil, mongo.CommandError{Code: 13, Name: "Unauthorized"}).Once()
+		errorC := make(chan error, 1)
+		metrics := testMetrics()
+
+		NewCollector(metric, mongoMock, errorC, metrics).Collect(make(chan prometheus.Metric, 1))
+
+		assert.Empty(t, errorC)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("", "myMetric", "myDB", "", "query_failed")))
+	})
+
+}
+
+// testMetrics returns internal metrics which are registered in a registry of their own
+func testMetrics() *Metrics {
+	return NewMetrics(prometheus.NewRegistry())
+}
+
+func findMock(metric Metric, docs ...bson.M) *mocks.IConnection {
+	mongoCursor := mocks.ICursor{}
+	for _, doc := range docs {
+		d := doc
+		mongoCursor.On("Next", mock.Anything).Return(true).Once()
+		mongoCursor.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			arg := args.Get(0).(*bson.M)
+			*arg = d
+		}).Once()
+	}
+	mongoCursor.On("Next", mock.Anything).Return(false).Once()
+	mongoCursor.On("Err").Return(nil).Once()
+	mongoCursor.On("Close", mock.Anything).Return(nil).Once()
+	mongoMock := mocks.IConnection{}
+	mongoMock.On("Find", mock.Anything, metric.Db, metric.Collection, mustParseDocument(metric.Find), mock.Anything).Return(&mongoCursor, nil).Once()
+	return &mongoMock
 }
 
 func testMetric() (Metric, bson.M) {
@@ -141,3 +290,172 @@ func testMetric() (Metric, bson.M) {
 
 	return metric, value
 }
+
+// collectScheduled collects the given scheduled collector and splits the result age from the cached metrics
+func collectScheduled(t *testing.T, c *Collector) (*dto.Metric, []*dto.Metric) {
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+
+	var age *dto.Metric
+	var metrics []*dto.Metric
+	for m := range ch {
+		out := &dto.Metric{}
+		assert.NoError(t, m.Write(out))
+		if strings.Contains(m.Desc().String(), resultAgeName) {
+			age = out
+		} else {
+			metrics = append(metrics, out)
+		}
+	}
+	return age, metrics
+}
+
+func TestScheduledCollect(t *testing.T) {
+	t.Run("serves cached result of the last successful refresh", func(t *testing.T) {
+		metric, doc := testMetric()
+		metric.Find = "{}"
+		metric.Interval = time.Minute
+
+		mongoMock := findMock(metric, doc)
+		c := NewCollector(metric, mongoMock, make(chan error, 1), testMetrics())
+
+		age, metrics := collectScheduled(t, c)
+		assert.Empty(t, metrics, "nothing is served before the first refresh")
+		assert.NotNil(t, age, "the age is served before the first refresh")
+
+		c.Refresh()
+		collectScheduled(t, c)
+		age, metrics = collectScheduled(t, c)
+
+		assert.Len(t, metrics, 1)
+		assert.Equal(t, 42.0, metrics[0].GetGauge().GetValue())
+		assert.Less(t, age.GetGauge().GetValue(), 1.0)
+		mongoMock.AssertNumberOfCalls(t, "Find", 1)
+	})
+
+	t.Run("exports the age of the result with the tags of the metric", func(t *testing.T) {
+		metric, _ := testMetric()
+		metric.Find = "{}"
+		metric.Interval = time.Minute
+		metric.Tags[TargetLabel] = "a"
+		c := NewCollector(metric, &mocks.IConnection{}, make(chan error, 1), testMetrics())
+		c.created = time.Now().Add(-time.Minute)
+
+		age, _ := collectScheduled(t, c)
+
+		assert.InDelta(t, 60.0, age.GetGauge().GetValue(), 1.0, "the age is counted from the creation until the first refresh")
+		labels := map[string]string{}
+		for _, l := range age.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		assert.Equal(t, map[string]string{"target": "a", "metric_name": "myMetric", "constTag": "value"}, labels)
+		// The collector describes the age, so that it can be registered on its own
+		assert.NoError(t, prometheus.NewRegistry().Register(c))
+	})
+
+	t.Run("keeps cached result if refresh fails", func(t *testing.T) {
+		metric, doc := testMetric()
+		metric.Find = "{}"
+		metric.Interval = time.Minute
+
+		mongoMock := findMock(metric, doc)
+		mongoMock.On("Find", mock.Anything, metric.Db, metric.Collection, mustParseDocument(metric.Find), mock.Anything).Return(nil, assert.AnError).Once()
+		c := NewCollector(metric, mongoMock, make(chan error, 1), testMetrics())
+
+		c.Refresh()
+		c.Refresh()
+
+		_, metrics := collectScheduled(t, c)
+		assert.Len(t, metrics, 1)
+		mongoMock.AssertExpectations(t)
+	})
+}
+
+func TestQueryTimeouts(t *testing.T) {
+	t.Run("maxTimeMS is passed to the query", func(t *testing.T) {
+		metric, _ := testMetric()
+		metric.Aggregate = "[]"
+		metric.MaxTimeMS = 1500
+
+		mongoCursor := mocks.ICursor{}
+		mongoCursor.On("Next", mock.Anything).Return(false).Once()
+		mongoCursor.On("Err").Return(nil).Once()
+		mongoCursor.On("Close", mock.Anything).Return(nil).Once()
+		mongoMock := mocks.IConnection{}
+		mongoMock.On("Aggregate", mock.Anything, metric.Db, metric.Collection, mustParsePipeline(metric.Aggregate), wrapper.QueryOptions{MaxTime: 1500 * time.Millisecond}).Return(&mongoCursor, nil).Once()
+
+		c := NewCollector(metric, &mongoMock, make(chan error, 1), testMetrics())
+		c.Collect(make(chan prometheus.Metric, 1))
+
+		mongoMock.AssertExpectations(t)
+	})
+
+	t.Run("find options are passed to the query", func(t *testing.T) {
+		metric, _ := testMetric()
+		metric.Find = "{}"
+		metric.Sort = `{"created": -1}`
+		metric.Limit = 10
+		metric.MaxTimeMS = 1500
+
+		mongoCursor := mocks.ICursor{}
+		mongoCursor.On("Next", mock.Anything).Return(false).Once()
+		mongoCursor.On("Err").Return(nil).Once()
+		mongoCursor.On("Close", mock.Anything).Return(nil).Once()
+		mongoMock := mocks.IConnection{}
+		expected := wrapper.QueryOptions{MaxTime: 1500 * time.Millisecond, Sort: driverbson.D{{Key: "created", Value: int32(-1)}}, Limit: 10}
+		mongoMock.On("Find", mock.Anything, metric.Db, metric.Collection, mustParseDocument(metric.Find), expected).Return(&mongoCursor, nil).Once()
+
+		c := NewCollector(metric, &mongoMock, make(chan error, 1), testMetrics())
+		c.Collect(make(chan prometheus.Metric, 1))
+
+		mongoMock.AssertExpectations(t)
+	})
+
+	t.Run("maxTimeMS defaults to the timeout", func(t *testing.T) {
+		c := NewCollector(Metric{Timeout: 3 * time.Second}, nil, make(chan error, 1), testMetrics())
+		assert.Equal(t, 3*time.Second, c.timeout())
+		assert.Equal(t, 3*time.Second, c.maxTime())
+
+		c = NewCollector(Metric{}, nil, make(chan error, 1), testMetrics())
+		assert.Equal(t, defaultQueryTimeout, c.timeout())
+	})
+
+	t.Run("classifies timeouts", func(t *testing.T) {
+		maxTimeErr := mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}
+		assert.Equal(t, "max_time_ms_expired", queryErrorType(fmt.Errorf("wrapped: %w", maxTimeErr), "query_failed"))
+		assert.Equal(t, "timeout", queryErrorType(context.DeadlineExceeded, "query_failed"))
+		assert.Equal(t, "query_failed", queryErrorType(assert.AnError, "query_failed"))
+	})
+}
+
+func TestCollectQueryTemplate(t *testing.T) {
+	t.Run("renders the query before each collection", func(t *testing.T) {
+		metric, value := testMetric()
+		metric.Find = `{"region": "{{ .region }}", "created": {"$gte": {{ now.Add "-5m" }}}}`
+		metric.Vars = map[string]string{"region": "eu"}
+		mongoMock := findMock(Metric{Db: metric.Db, Collection: metric.Collection, Find: "{}"}, value)
+		mongoMock.ExpectedCalls[0].Arguments[3] = mock.MatchedBy(func(filter driverbson.D) bool {
+			created := filter[1].Value.(driverbson.D)[0].Value.(primitive.DateTime).Time()
+			return filter[0].Value == "eu" && time.Since(created) >= 5*time.Minute && time.Since(created) < 6*time.Minute
+		})
+		ch := make(chan prometheus.Metric, 1)
+
+		NewCollector(metric, mongoMock, make(chan error, 1), testMetrics()).Collect(ch)
+
+		assert.Equal(t, 1, len(ch))
+		mongoMock.AssertExpectations(t)
+	})
+
+	t.Run("reports failed templates", func(t *testing.T) {
+		metric, _ := testMetric()
+		metric.Find = `{"region": "{{ .region }}"}`
+		errorC := make(chan error, 1)
+		metrics := testMetrics()
+
+		NewCollector(metric, &mocks.IConnection{}, errorC, metrics).Collect(make(chan prometheus.Metric, 1))
+
+		assert.Empty(t, errorC)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("", metric.Name, metric.Db, metric.Collection, "invalid_query")))
+	})
+}
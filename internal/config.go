@@ -1,16 +1,33 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	
 	"gopkg.in/yaml.v2"
 )
 
 var prometheusNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var prometheusLabelRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// TargetLabel is added to every metric collected from one of the configured targets
+const TargetLabel = "target"
+
+// Supported values of Metric.Type
+const (
+	MetricTypeGauge     = "gauge"
+	MetricTypeCounter   = "counter"
+	MetricTypeUntyped   = "untyped"
+	MetricTypeInfo      = "info"
+	MetricTypeHistogram = "histogram"
+	MetricTypeSummary   = "summary"
+)
 
 // ReadConfigFile Initializes a Config instance from a given file path
 func ReadConfigFile(configFile string) (Config, error) {
@@ -30,11 +47,19 @@ func ReadConfig(data []byte) (Config, error) {
 	
 	// Apply environment variable overrides
 	applyEnvOverrides(&c)
-	
+	return PrepareConfig(c)
+}
+
+// PrepareConfig applies the mongodb query defaults to all metrics and validates the config
+// ReadConfig prepares the configs it reads; configs built in code are prepared by the exporter.
+func PrepareConfig(c Config) (Config, error) {
+	// The metrics of the given config are not modified
+	c.Metrics = append([]Metric(nil), c.Metrics...)
+	applyQueryDefaults(&c)
+
 	if err := validateConfigStructure(c); err != nil {
 		return Config{}, fmt.Errorf("config validation failed: %w", err)
 	}
-	
 	return c, nil
 }
 
@@ -62,19 +87,81 @@ func applyEnvOverrides(c *Config) {
 	}
 }
 
+// applyQueryDefaults applies the global mongodb query timeouts to all metrics which do not define their own
+func applyQueryDefaults(c *Config) {
+	for i := range c.Metrics {
+		if c.Metrics[i].Timeout == 0 {
+			c.Metrics[i].Timeout = c.MongoDb.Timeout
+		}
+		if c.Metrics[i].MaxTimeMS == 0 {
+			c.Metrics[i].MaxTimeMS = c.MongoDb.MaxTimeMS
+		}
+		if c.Metrics[i].ReadPreference == nil {
+			c.Metrics[i].ReadPreference = c.MongoDb.ReadPreference
+		}
+		// Commands specify their read concern in the command document
+		if c.Metrics[i].ReadConcern == "" && strings.TrimSpace(c.Metrics[i].Command) == "" {
+			c.Metrics[i].ReadConcern = c.MongoDb.ReadConcern
+		}
+	}
+}
+
 func validateConfigStructure(c Config) error {
 	// Validate HTTP config
 	if c.HTTP.Port <= 0 || c.HTTP.Port > 65535 {
 		return fmt.Errorf("invalid HTTP port: %d", c.HTTP.Port)
 	}
+	if c.HTTP.TLS != nil {
+		if err := validateTLS(*c.HTTP.TLS); err != nil {
+			return fmt.Errorf("http.tls: %w", err)
+		}
+	}
+	if c.HTTP.Auth != nil {
+		if err := validateAuth(*c.HTTP.Auth); err != nil {
+			return fmt.Errorf("http.auth: %w", err)
+		}
+	}
+	if c.Builtin.CollStats != nil {
+		if err := validateDiscovery(*c.Builtin.CollStats); err != nil {
+			return fmt.Errorf("builtin.collStats: %w", err)
+		}
+	}
+	if c.Builtin.IndexStats != nil {
+		if err := validateDiscovery(*c.Builtin.IndexStats); err != nil {
+			return fmt.Errorf("builtin.indexStats: %w", err)
+		}
+	}
+	if c.Builtin.CurrentOp != nil {
+		if err := validateCurrentOp(*c.Builtin.CurrentOp); err != nil {
+			return fmt.Errorf("builtin.currentOp: %w", err)
+		}
+	}
 	
 	// Validate MongoDB config
-	if strings.TrimSpace(c.MongoDb.URI) == "" {
+	if strings.TrimSpace(c.MongoDb.URI) == "" && len(c.Targets) == 0 {
 		return fmt.Errorf("MongoDB URI cannot be empty")
 	}
 	
+	if c.MongoDb.Timeout < 0 || c.MongoDb.MaxTimeMS < 0 {
+		return fmt.Errorf("MongoDB timeout and maxTimeMS cannot be negative")
+	}
+	if c.MongoDb.ReadPreference != nil {
+		if _, err := newReadPref(*c.MongoDb.ReadPreference); err != nil {
+			return fmt.Errorf("mongodb.readPreference: %w", err)
+		}
+	}
+	if c.MongoDb.ReadConcern != "" {
+		if _, err := newReadConcern(c.MongoDb.ReadConcern); err != nil {
+			return fmt.Errorf("mongodb.readConcern: %w", err)
+		}
+	}
+	
+	if c.Collection.MaxConcurrency < 0 || c.Collection.MaxConcurrencyPerDatabase < 0 {
+		return fmt.Errorf("collection concurrency limits cannot be negative")
+	}
+	
 	// Validate metrics
-	if len(c.Metrics) == 0 {
+	if len(c.Metrics) == 0 && !c.Builtin.Enabled() {
 		return fmt.Errorf("at least one metric must be configured")
 	}
 	
@@ -84,9 +171,109 @@ func validateConfigStructure(c Config) error {
 		}
 	}
 	
+	return validateTargets(c)
+}
+
+func validateTargets(c Config) error {
+	names := make(map[string]bool, len(c.Targets))
+	for i, t := range c.Targets {
+		if strings.TrimSpace(t.Name) == "" {
+			return fmt.Errorf("target[%d]: name cannot be empty", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("target[%d]: duplicate target name '%s'", i, t.Name)
+		}
+		names[t.Name] = true
+		if strings.TrimSpace(t.URI) == "" {
+			return fmt.Errorf("target[%d]: uri cannot be empty", i)
+		}
+		for label := range t.Labels {
+			if !prometheusLabelRegex.MatchString(label) || label == TargetLabel {
+				return fmt.Errorf("target[%d]: invalid label name '%s'", i, label)
+			}
+		}
+	}
+
+	resumeTokenFiles := make(map[string]bool)
+	for i, m := range c.Metrics {
+		if m.Module != "" && (len(c.Targets) == 0 || strings.TrimSpace(c.HTTP.Probe) == "") {
+			return fmt.Errorf("metric[%d]: module requires a 'targets' section and an 'http.probe' endpoint", i)
+		}
+		if len(m.Targets) > 0 && len(c.Targets) == 0 {
+			return fmt.Errorf("metric[%d]: targets require a 'targets' section", i)
+		}
+		for _, name := range m.Targets {
+			if !names[name] {
+				return fmt.Errorf("metric[%d]: unknown target '%s'", i, name)
+			}
+		}
+		if err := validateResumeTokenFile(c, m, i, resumeTokenFiles); err != nil {
+			return err
+		}
+		for _, t := range c.MongoTargets() {
+			if !m.UsesTarget(t.Name) {
+				continue
+			}
+			if err := validateQueryTemplate(m.ForTarget(t)); err != nil {
+				return fmt.Errorf("metric[%d]: query template of target '%s': %w", i, t.Name, err)
+			}
+			for label := range t.Labels {
+				if _, exists := m.Tags[label]; exists {
+					return fmt.Errorf("metric[%d]: tag '%s' collides with a label of target '%s'", i, label, t.Name)
+				}
+				if _, exists := m.TagAttributes[label]; exists {
+					return fmt.Errorf("metric[%d]: tag attribute '%s' collides with a label of target '%s'", i, label, t.Name)
+				}
+			}
+		}
+		if len(c.Targets) > 0 {
+			if _, exists := m.Tags[TargetLabel]; exists {
+				return fmt.Errorf("metric[%d]: tag '%s' is reserved for the target name", i, TargetLabel)
+			}
+			if _, exists := m.TagAttributes[TargetLabel]; exists {
+				return fmt.Errorf("metric[%d]: tag attribute '%s' is reserved for the target name", i, TargetLabel)
+			}
+		}
+	}
+	return nil
+}
+
+// validateResumeTokenFile ensures that each resume token file belongs to the change stream of a single target
+func validateResumeTokenFile(c Config, m Metric, index int, files map[string]bool) error {
+	if m.ResumeTokenFile == "" {
+		return nil
+	}
+	if files[m.ResumeTokenFile] {
+		return fmt.Errorf("metric[%d]: resumeTokenFile '%s' is used by several metrics", index, m.ResumeTokenFile)
+	}
+	files[m.ResumeTokenFile] = true
+	targets := 0
+	for _, t := range c.MongoTargets() {
+		if m.UsesTarget(t.Name) {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return fmt.Errorf("metric[%d]: resumeTokenFile requires the metric to be collected from a single target", index)
+	}
 	return nil
 }
 
+// validateQueryTemplate renders and parses the query once, so that missing variables and malformed queries fail
+// at load instead of at each collection
+func validateQueryTemplate(m Metric) error {
+	q, err := parseQueryTemplate(m.Name, m.Query(), m.Vars)
+	if err != nil || !q.hasPlaceholders() {
+		return err
+	}
+	query, err := q.render(time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = parseQuery(m, query)
+	return err
+}
+
 func validateMetric(m Metric, index int) error {
 	if strings.TrimSpace(m.Name) == "" {
 		return fmt.Errorf("metric[%d]: name cannot be empty", index)
@@ -100,31 +287,266 @@ func validateMetric(m Metric, index int) error {
 		return fmt.Errorf("metric[%d]: database name cannot be empty", index)
 	}
 	
-	if strings.TrimSpace(m.Collection) == "" {
-		return fmt.Errorf("metric[%d]: collection name cannot be empty", index)
+	queries := 0
+	for _, q := range []string{m.Find, m.Aggregate, m.Command, m.ChangeStream} {
+		if strings.TrimSpace(q) != "" {
+			queries++
+		}
+	}
+	if queries == 0 {
+		return fmt.Errorf("metric[%d]: either 'find', 'aggregate', 'command' or 'changeStream' query must be specified", index)
 	}
 	
-	if strings.TrimSpace(m.Find) == "" && strings.TrimSpace(m.Aggregate) == "" {
-		return fmt.Errorf("metric[%d]: either 'find' or 'aggregate' query must be specified", index)
+	if queries > 1 {
+		return fmt.Errorf("metric[%d]: only one of 'find', 'aggregate', 'command' and 'changeStream' queries can be specified", index)
+	}
+
+	q, err := parseQueryTemplate(m.Name, m.Query(), m.Vars)
+	if err != nil {
+		return fmt.Errorf("metric[%d]: invalid query template: %w", index, err)
+	}
+	// Templates are parsed once they are rendered for their targets, see validateQueryTemplate
+	if !q.hasPlaceholders() {
+		if _, err := parseQuery(m, m.Query()); err != nil {
+			return fmt.Errorf("metric[%d]: invalid query: %w", index, err)
+		}
+	}
+
+	if err := validateQueryOptions(m, index); err != nil {
+		return err
 	}
 	
-	if strings.TrimSpace(m.Find) != "" && strings.TrimSpace(m.Aggregate) != "" {
-		return fmt.Errorf("metric[%d]: cannot specify both 'find' and 'aggregate' queries", index)
+	// Commands name their collection, if any, in the command document; change streams may watch the whole database
+	if strings.TrimSpace(m.Collection) == "" && strings.TrimSpace(m.Command) == "" && strings.TrimSpace(m.ChangeStream) == "" {
+		return fmt.Errorf("metric[%d]: collection name cannot be empty", index)
+	}
+	
+	if strings.TrimSpace(m.ChangeStream) != "" {
+		return validateChangeStream(m, index)
+	}
+	if m.ResumeTokenFile != "" {
+		return fmt.Errorf("metric[%d]: resumeTokenFile is only supported for change streams", index)
 	}
 	
-	if strings.TrimSpace(m.MetricsAttribute) == "" {
-		return fmt.Errorf("metric[%d]: metricsAttribute cannot be empty", index)
+	if m.Interval < 0 {
+		return fmt.Errorf("metric[%d]: interval cannot be negative", index)
+	}
+
+	if m.Timeout < 0 || m.MaxTimeMS < 0 {
+		return fmt.Errorf("metric[%d]: timeout and maxTimeMS cannot be negative", index)
+	}
+
+	if len(m.Values) > 0 {
+		return validateValues(m, index)
+	}
+
+	switch m.Type {
+	case "", MetricTypeGauge, MetricTypeCounter, MetricTypeUntyped:
+		if strings.TrimSpace(m.MetricsAttribute) == "" {
+			return fmt.Errorf("metric[%d]: metricsAttribute cannot be empty", index)
+		}
+	case MetricTypeInfo:
+		if strings.TrimSpace(m.MetricsAttribute) != "" {
+			return fmt.Errorf("metric[%d]: metricsAttribute is not supported for info metrics", index)
+		}
+	case MetricTypeHistogram:
+		if err := validateHistogram(m, index); err != nil {
+			return err
+		}
+	case MetricTypeSummary:
+		if err := validateSummary(m, index); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("metric[%d]: unsupported metric type '%s'", index, m.Type)
 	}
 	
 	return nil
 }
 
+func validateQueryOptions(m Metric, index int) error {
+	find := strings.TrimSpace(m.Find) != ""
+	aggregate := strings.TrimSpace(m.Aggregate) != ""
+	if !find && (m.Projection != "" || m.Sort != "" || m.Limit != 0 || m.Skip != 0) {
+		return fmt.Errorf("metric[%d]: projection, sort, limit and skip are only supported for find queries", index)
+	}
+	if !find && !aggregate && (m.Hint != "" || m.Collation != "" || m.BatchSize != 0) {
+		return fmt.Errorf("metric[%d]: hint, collation and batchSize are only supported for find and aggregate queries", index)
+	}
+	if m.Limit < 0 || m.Skip < 0 || m.BatchSize < 0 {
+		return fmt.Errorf("metric[%d]: limit, skip and batchSize cannot be negative", index)
+	}
+	if strings.TrimSpace(m.Command) != "" && m.ReadConcern != "" {
+		return fmt.Errorf("metric[%d]: readConcern is not supported for commands, which specify it in the command document", index)
+	}
+	if _, err := queryOptions(m); err != nil {
+		return fmt.Errorf("metric[%d]: %w", index, err)
+	}
+	return nil
+}
+
+func validateValues(m Metric, index int) error {
+	if strings.TrimSpace(m.MetricsAttribute) != "" {
+		return fmt.Errorf("metric[%d]: cannot specify both 'metricsAttribute' and 'values'", index)
+	}
+	if !isScalarType(m.Type) {
+		return fmt.Errorf("metric[%d]: values are not supported for %s metrics", index, m.Type)
+	}
+
+	names := make(map[string]bool, len(m.Values))
+	for i, v := range m.Values {
+		if strings.TrimSpace(v.Attribute) == "" {
+			return fmt.Errorf("metric[%d].values[%d]: attribute cannot be empty", index, i)
+		}
+		if v.Name != "" && v.Suffix != "" {
+			return fmt.Errorf("metric[%d].values[%d]: cannot specify both 'name' and 'suffix'", index, i)
+		}
+		if v.Name == "" && v.Suffix == "" {
+			return fmt.Errorf("metric[%d].values[%d]: either 'name' or 'suffix' must be specified", index, i)
+		}
+		name := v.MetricName(m.Name)
+		if !prometheusNameRegex.MatchString(name) {
+			return fmt.Errorf("metric[%d].values[%d]: invalid Prometheus metric name '%s'", index, i, name)
+		}
+		if names[name] {
+			return fmt.Errorf("metric[%d].values[%d]: duplicate metric name '%s'", index, i, name)
+		}
+		names[name] = true
+		if !isScalarType(v.Type) {
+			return fmt.Errorf("metric[%d].values[%d]: unsupported value type '%s'", index, i, v.Type)
+		}
+	}
+	return nil
+}
+
+// isScalarType reports whether the metric type exports a single number per result document
+func isScalarType(metricType string) bool {
+	switch metricType {
+	case "", MetricTypeGauge, MetricTypeCounter, MetricTypeUntyped:
+		return true
+	}
+	return false
+}
+
+func validateHistogram(m Metric, index int) error {
+	if strings.TrimSpace(m.MetricsAttribute) != "" {
+		return fmt.Errorf("metric[%d]: metricsAttribute is not supported for histogram metrics, use countAttribute", index)
+	}
+	if strings.TrimSpace(m.BucketAttribute) == "" {
+		return fmt.Errorf("metric[%d]: bucketAttribute cannot be empty for histogram metrics", index)
+	}
+	if strings.TrimSpace(m.CountAttribute) == "" {
+		return fmt.Errorf("metric[%d]: countAttribute cannot be empty for histogram metrics", index)
+	}
+	switch m.BucketBoundary {
+	case "", BucketBoundaryUpper, BucketBoundaryLower:
+	default:
+		return fmt.Errorf("metric[%d]: unsupported bucketBoundary '%s'", index, m.BucketBoundary)
+	}
+	return nil
+}
+
+func validateSummary(m Metric, index int) error {
+	if strings.TrimSpace(m.MetricsAttribute) != "" {
+		return fmt.Errorf("metric[%d]: metricsAttribute is not supported for summary metrics, use countAttribute", index)
+	}
+	if strings.TrimSpace(m.CountAttribute) == "" {
+		return fmt.Errorf("metric[%d]: countAttribute cannot be empty for summary metrics", index)
+	}
+	if len(m.QuantileAttributes) == 0 {
+		return fmt.Errorf("metric[%d]: quantileAttributes cannot be empty for summary metrics", index)
+	}
+	for quantile := range m.QuantileAttributes {
+		if quantile < 0 || quantile > 1 {
+			return fmt.Errorf("metric[%d]: quantile %v must be between 0 and 1", index, quantile)
+		}
+	}
+	return nil
+}
+
+func validateChangeStream(m Metric, index int) error {
+	switch m.Type {
+	case "", MetricTypeCounter:
+	default:
+		return fmt.Errorf("metric[%d]: change streams only support counter metrics", index)
+	}
+	if strings.TrimSpace(m.MetricsAttribute) != "" || len(m.Values) > 0 {
+		return fmt.Errorf("metric[%d]: metricsAttribute and values are not supported for change streams, which count events", index)
+	}
+	if m.Interval != 0 {
+		return fmt.Errorf("metric[%d]: interval is not supported for change streams", index)
+	}
+	if m.Module != "" {
+		return fmt.Errorf("metric[%d]: change streams cannot be part of a module", index)
+	}
+	if _, exists := m.TagAttributes[changeStreamOperationLabel]; exists {
+		return fmt.Errorf("metric[%d]: tagAttributes cannot contain the label '%s'", index, changeStreamOperationLabel)
+	}
+	if _, exists := m.Tags[changeStreamOperationLabel]; exists {
+		return fmt.Errorf("metric[%d]: tags cannot contain the label '%s'", index, changeStreamOperationLabel)
+	}
+	return nil
+}
+
 // Config Root config struct
 type Config struct {
-	Version string  `yaml:"version"`
-	HTTP    HTTP    `yaml:"http"`
-	MongoDb MongoDB `yaml:"mongodb"`
-	Metrics []Metric `yaml:"metrics"`
+	Version         string          `yaml:"version"`
+	HTTP            HTTP            `yaml:"http"`
+	MongoDb         MongoDB         `yaml:"mongodb"`
+	Targets         []Target        `yaml:"targets"`
+	Collection      Collection      `yaml:"collection"`
+	InternalMetrics InternalMetrics `yaml:"internalMetrics"`
+	Builtin         Builtin         `yaml:"builtin"`
+	Metrics         []Metric        `yaml:"metrics"`
+}
+
+// Hash returns a hash of the config, which fits into the float64 value of a metric without loss
+func (c Config) Hash() float64 {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return 0
+	}
+	sum := sha256.Sum256(data)
+	// Use the first 48 bits only, which are represented exactly by a float64
+	var b [8]byte
+	copy(b[2:], sum[:6])
+	return float64(binary.BigEndian.Uint64(b[:]))
+}
+
+// MongoTargets returns all MongoDB deployments to collect metrics from
+// Without configured targets, the single mongodb.uri is returned as unnamed target
+func (c Config) MongoTargets() []Target {
+	if len(c.Targets) == 0 {
+		return []Target{{URI: c.MongoDb.URI}}
+	}
+	return c.Targets
+}
+
+// MetricsFor returns the metrics to collect from the given target, labelled with the target
+// Metrics assigned to a module are only collected on probe requests and therefore excluded
+func (c Config) MetricsFor(t Target) []Metric {
+	return c.ModuleMetrics("", t)
+}
+
+// ModuleMetrics returns the metrics of the given module to collect from the given target, labelled with the target
+func (c Config) ModuleMetrics(module string, t Target) []Metric {
+	metrics := make([]Metric, 0, len(c.Metrics))
+	for _, m := range c.Metrics {
+		if m.Module == module && m.UsesTarget(t.Name) {
+			metrics = append(metrics, m.ForTarget(t))
+		}
+	}
+	return metrics
+}
+
+// Target returns the configured target with the given name
+func (c Config) Target(name string) (Target, bool) {
+	for _, t := range c.Targets {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Target{}, false
 }
 
 type HTTP struct {
@@ -132,21 +554,234 @@ type HTTP struct {
 	Prometheus string `yaml:"prometheus"`
 	Health     string `yaml:"health"`
 	Liveliness string `yaml:"liveliness"`
+	Probe      string `yaml:"probe"`
+	Reload     string `yaml:"reload"`
+	TLS        *TLS   `yaml:"tls"`
+	Auth       *Auth  `yaml:"auth"`
+}
+
+// Auth requires clients of the protected http endpoints to authenticate
+// via basic auth with a bcrypt hashed password or via a bearer token
+type Auth struct {
+	BasicAuthUsers   map[string]string `yaml:"basic_auth_users"`
+	BearerTokenFiles []string          `yaml:"bearer_token_files"`
+	Endpoints        []string          `yaml:"endpoints"`
+}
+
+// TLS serves the http endpoints via HTTPS
+// The keys follow the tls_server_config of the prometheus exporter-toolkit web config
+type TLS struct {
+	CertFile       string   `yaml:"cert_file"`
+	KeyFile        string   `yaml:"key_file"`
+	ClientAuthType string   `yaml:"client_auth_type"`
+	ClientCAFile   string   `yaml:"client_ca_file"`
+	MinVersion     string   `yaml:"min_version"`
+	MaxVersion     string   `yaml:"max_version"`
+	CipherSuites   []string `yaml:"cipher_suites"`
 }
 
 type MongoDB struct {
-	URI string `yaml:"uri"`
+	URI       string        `yaml:"uri"`
+	Timeout   time.Duration `yaml:"timeout"`
+	MaxTimeMS int64         `yaml:"maxTimeMS"`
+	// ReadPreference and ReadConcern are the defaults of all metrics
+	ReadPreference *ReadPreference `yaml:"readPreference"`
+	ReadConcern    string          `yaml:"readConcern"`
+}
+
+// ReadPreference selects the replica set members which serve the queries of a metric
+type ReadPreference struct {
+	Mode                string              `yaml:"mode"`
+	TagSets             []map[string]string `yaml:"tagSets"`
+	MaxStalenessSeconds int64               `yaml:"maxStalenessSeconds"`
+}
+
+// Target is a named MongoDB deployment, whose name and labels are added to all of its metrics
+type Target struct {
+	Name   string            `yaml:"name"`
+	URI    string            `yaml:"uri"`
+	Labels map[string]string `yaml:"labels"`
+	// Vars are available in the queries of all metrics of the target, see queryTemplate
+	Vars map[string]string `yaml:"vars"`
+}
+
+// ConstLabels returns the labels added to all metrics of the target
+// The unnamed default target has no labels
+func (t Target) ConstLabels() map[string]string {
+	if t.Name == "" {
+		return nil
+	}
+	labels := make(map[string]string, len(t.Labels)+1)
+	for k, v := range t.Labels {
+		labels[k] = v
+	}
+	labels[TargetLabel] = t.Name
+	return labels
+}
+
+// Collection limits how many queries may hit mongoDB at once; zero means unlimited
+type Collection struct {
+	MaxConcurrency            int `yaml:"maxConcurrency"`
+	MaxConcurrencyPerDatabase int `yaml:"maxConcurrencyPerDatabase"`
+}
+
+// InternalMetrics selects the runtime metrics served in addition to the internal metrics of the exporter
+type InternalMetrics struct {
+	DisableGoCollector      bool `yaml:"disableGoCollector"`
+	DisableProcessCollector bool `yaml:"disableProcessCollector"`
+}
+
+// Builtin enables built-in collectors, which are collected from every target in addition to the metrics
+type Builtin struct {
+	ServerStatus  bool       `yaml:"serverStatus"`
+	ReplSetStatus bool       `yaml:"replSetStatus"`
+	CollStats     *Discovery `yaml:"collStats"`
+	IndexStats    *Discovery `yaml:"indexStats"`
+	CurrentOp     *CurrentOp `yaml:"currentOp"`
+}
+
+// Enabled reports whether any built-in collector is enabled
+func (b Builtin) Enabled() bool {
+	return b.ServerStatus || b.ReplSetStatus || b.CollStats != nil || b.IndexStats != nil || b.CurrentOp != nil
+}
+
+// CurrentOp counts the active operations of a target, which run at least as long as the thresholds
+// Include and Exclude are regular expressions matched against the namespace of the operations.
+type CurrentOp struct {
+	Thresholds []time.Duration `yaml:"thresholds"`
+	Include    string          `yaml:"include"`
+	Exclude    string          `yaml:"exclude"`
+}
+
+// Discovery selects the collections of a target, which a built-in collector exports statistics for
+// Without Collections, all collections are discovered. Include and Exclude are regular expressions
+// matched against the namespace "db.collection".
+type Discovery struct {
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	Collections     []string      `yaml:"collections"`
+	Include         string        `yaml:"include"`
+	Exclude         string        `yaml:"exclude"`
 }
 
 // Metric Collector configuration
 type Metric struct {
 	Name             string            `yaml:"name"`
 	Help             string            `yaml:"help"`
+	Type             string            `yaml:"type"`
 	Db               string            `yaml:"db"`
 	Collection       string            `yaml:"collection"`
 	Tags             map[string]string `yaml:"tags"`
 	Find             string            `yaml:"find"`
 	Aggregate        string            `yaml:"aggregate"`
+	Command          string            `yaml:"command"`
+	ChangeStream     string            `yaml:"changeStream"`
 	MetricsAttribute string            `yaml:"metricsAttribute"`
 	TagAttributes    map[string]string `yaml:"tagAttributes"`
+	Interval         time.Duration     `yaml:"interval"`
+	Timeout          time.Duration     `yaml:"timeout"`
+	MaxTimeMS        int64             `yaml:"maxTimeMS"`
+
+	// Find options; hint, collation and batchSize also apply to aggregates
+	Projection string `yaml:"projection"`
+	Sort       string `yaml:"sort"`
+	Limit      int64  `yaml:"limit"`
+	Skip       int64  `yaml:"skip"`
+	Hint       string `yaml:"hint"`
+	Collation  string `yaml:"collation"`
+	BatchSize  int32  `yaml:"batchSize"`
+
+	// ReadPreference and ReadConcern default to the ones of the mongodb section
+	ReadPreference *ReadPreference `yaml:"readPreference"`
+	ReadConcern    string          `yaml:"readConcern"`
+
+	// ResumeTokenFile persists the resume token of a change stream, so that it resumes after a restart
+	ResumeTokenFile string `yaml:"resumeTokenFile"`
+
+	// Vars are available in the query; variables of the target take precedence
+	Vars map[string]string `yaml:"vars"`
+
+	// Histogram and summary attributes
+	BucketAttribute    string             `yaml:"bucketAttribute"`
+	BucketBoundary     string             `yaml:"bucketBoundary"`
+	CountAttribute     string             `yaml:"countAttribute"`
+	SumAttribute       string             `yaml:"sumAttribute"`
+	QuantileAttributes map[float64]string `yaml:"quantileAttributes"`
+
+	Values []MetricValue `yaml:"values"`
+
+	// Targets to collect the metric from; all targets if empty
+	Targets []string `yaml:"targets"`
+	// Module groups metrics which are only collected on probe requests
+	Module string `yaml:"module"`
+}
+
+// UsesTarget reports whether the metric is collected from the target with the given name
+func (m Metric) UsesTarget(name string) bool {
+	if len(m.Targets) == 0 {
+		return true
+	}
+	for _, t := range m.Targets {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ForTarget returns a copy of the metric whose tags contain the name and labels of the given target
+// and whose vars contain the vars of the target
+// Metrics of the unnamed default target are returned unchanged
+func (m Metric) ForTarget(t Target) Metric {
+	if t.Name == "" {
+		return m
+	}
+	tags := make(map[string]string, len(m.Tags)+len(t.Labels)+1)
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	for k, v := range t.Labels {
+		tags[k] = v
+	}
+	tags[TargetLabel] = t.Name
+	m.Tags = tags
+
+	if len(t.Vars) > 0 {
+		vars := make(map[string]string, len(m.Vars)+len(t.Vars))
+		for k, v := range m.Vars {
+			vars[k] = v
+		}
+		for k, v := range t.Vars {
+			vars[k] = v
+		}
+		m.Vars = vars
+	}
+	return m
+}
+
+// Query returns the configured find, aggregate, command or change stream query
+func (m Metric) Query() string {
+	for _, q := range []string{m.Find, m.Aggregate, m.Command, m.ChangeStream} {
+		if strings.TrimSpace(q) != "" {
+			return q
+		}
+	}
+	return ""
+}
+
+// MetricValue configures one of several values exported from the same query result
+type MetricValue struct {
+	Attribute string `yaml:"attribute"`
+	Name      string `yaml:"name"`
+	Suffix    string `yaml:"suffix"`
+	Help      string `yaml:"help"`
+	Type      string `yaml:"type"`
+}
+
+// MetricName returns the full metric name of the value
+// A suffix is appended to the name of the enclosing metric, separated by an underscore
+func (v MetricValue) MetricName(base string) string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return base + "_" + v.Suffix
 }
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTargets(t *testing.T) {
+	yaml := `
+version: 1.0
+http:
+  port: 9090
+targets:
+  - name: cluster-a
+    uri: mongodb://a:27017
+    labels:
+      env: prod
+  - name: cluster-b
+    uri: mongodb://b:27017
+metrics:
+  - name: all_targets_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+  - name: single_target_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+    targets: [cluster-b]
+`
+
+	c, err := ReadConfig([]byte(yaml))
+
+	assert.NoError(t, err)
+	assert.Equal(t, c.Targets, c.MongoTargets())
+
+	metricsA := c.MetricsFor(c.Targets[0])
+	assert.Equal(t, 1, len(metricsA))
+	assert.Equal(t, map[string]string{"env": "prod", TargetLabel: "cluster-a"}, metricsA[0].Tags)
+
+	metricsB := c.MetricsFor(c.Targets[1])
+	assert.Equal(t, 2, len(metricsB))
+	assert.Equal(t, map[string]string{TargetLabel: "cluster-b"}, metricsB[1].Tags)
+}
+
+func TestMongoTargetsWithoutTargets(t *testing.T) {
+	c := Config{
+		MongoDb: MongoDB{URI: "mongodb://localhost:27017"},
+		Metrics: []Metric{{Name: "test", Tags: map[string]string{"constTag": "value"}}},
+	}
+
+	targets := c.MongoTargets()
+
+	assert.Equal(t, []Target{{URI: "mongodb://localhost:27017"}}, targets)
+	assert.Equal(t, c.Metrics, c.MetricsFor(targets[0]), "metrics of the default target are not labelled")
+}
+
+func TestValidateTargets(t *testing.T) {
+	metric := Metric{Name: "test", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count"}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "targets without mongodb uri",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []Metric{metric},
+			},
+			wantErr: false,
+		},
+		{
+			name: "module without probe endpoint",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count", Module: "m"}},
+			},
+			wantErr: true,
+			errMsg:  "module requires a 'targets' section and an 'http.probe' endpoint",
+		},
+		{
+			name: "duplicate target name",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}, {Name: "a", URI: "mongodb://b:27017"}},
+				Metrics: []Metric{metric},
+			},
+			wantErr: true,
+			errMsg:  "duplicate target name 'a'",
+		},
+		{
+			name: "target without uri",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a"}},
+				Metrics: []Metric{metric},
+			},
+			wantErr: true,
+			errMsg:  "target[0]: uri cannot be empty",
+		},
+		{
+			name: "unknown target reference",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count", Targets: []string{"b"}}},
+			},
+			wantErr: true,
+			errMsg:  "unknown target 'b'",
+		},
+		{
+			name: "target label collides with tag attribute",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017", Labels: map[string]string{"type": "x"}}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count", TagAttributes: map[string]string{"type": "_id"}}},
+			},
+			wantErr: true,
+			errMsg:  "tag attribute 'type' collides with a label of target 'a'",
+		},
+		{
+			name: "reserved target tag",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: "{}", MetricsAttribute: "count", Tags: map[string]string{"target": "x"}}},
+			},
+			wantErr: true,
+			errMsg:  "tag 'target' is reserved",
+		},
+		{
+			name: "resume token file of several targets",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}, {Name: "b", URI: "mongodb://b:27017"}},
+				Metrics: []Metric{{Name: "test", Db: "db", ChangeStream: "[]", ResumeTokenFile: "test.token"}},
+			},
+			wantErr: true,
+			errMsg:  "resumeTokenFile requires the metric to be collected from a single target",
+		},
+		{
+			name: "resume token file of a single target",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}, {Name: "b", URI: "mongodb://b:27017"}},
+				Metrics: []Metric{{Name: "test", Db: "db", ChangeStream: "[]", ResumeTokenFile: "test.token", Targets: []string{"a"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "resume token file of several metrics",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017"}},
+				Metrics: []Metric{
+					{Name: "test", Db: "db", ChangeStream: "[]", ResumeTokenFile: "test.token"},
+					{Name: "other", Db: "db", ChangeStream: "[]", ResumeTokenFile: "test.token"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "resumeTokenFile 'test.token' is used by several metrics",
+		},
+		{
+			name: "query variable of the target",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017", Vars: map[string]string{"region": "eu"}}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: `{"region": "{{ .region }}"}`, MetricsAttribute: "count"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "query variable missing for a target",
+			config: Config{
+				HTTP: HTTP{Port: 9090},
+				Targets: []Target{
+					{Name: "a", URI: "mongodb://a:27017", Vars: map[string]string{"region": "eu"}},
+					{Name: "b", URI: "mongodb://b:27017"},
+				},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: `{"region": "{{ .region }}"}`, MetricsAttribute: "count"}},
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: query template of target 'b'",
+		},
+		{
+			name: "rendered query template is malformed",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				Targets: []Target{{Name: "a", URI: "mongodb://a:27017", Vars: map[string]string{"region": "eu"}}},
+				Metrics: []Metric{{Name: "test", Db: "db", Collection: "col", Find: `{"region": {{ .region }}}`, MetricsAttribute: "count"}},
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: query template of target 'a': invalid JSON at offset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfigStructure(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMetricVarsForTarget(t *testing.T) {
+	metric := Metric{Name: "test", Vars: map[string]string{"region": "eu", "tier": "gold"}}
+
+	m := metric.ForTarget(Target{Name: "a", Vars: map[string]string{"region": "us"}})
+
+	assert.Equal(t, map[string]string{"region": "us", "tier": "gold"}, m.Vars)
+	assert.Equal(t, "eu", metric.Vars["region"], "the vars of the metric are not modified")
+}
+
+func TestModuleMetrics(t *testing.T) {
+	target := Target{Name: "a", URI: "mongodb://a:27017"}
+	c := Config{
+		Targets: []Target{target},
+		Metrics: []Metric{{Name: "scraped"}, {Name: "probed", Module: "m"}},
+	}
+
+	assert.Equal(t, "scraped", c.MetricsFor(target)[0].Name)
+	assert.Equal(t, 1, len(c.MetricsFor(target)), "module metrics are only collected on probe")
+	assert.Equal(t, "probed", c.ModuleMetrics("m", target)[0].Name)
+	assert.Empty(t, c.ModuleMetrics("unknown", target))
+}
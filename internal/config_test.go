@@ -2,6 +2,7 @@ package internal
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,3 +71,105 @@ func TestParseInvalidValueReturnsError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to parse config")
 }
+
+func TestParseSummaryQuantileAttributes(t *testing.T) {
+	yaml := `
+version: 1.0
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+metrics:
+  - name: latency_seconds
+    type: summary
+    db: testdb
+    collection: testcol
+    find: '{}'
+    countAttribute: count
+    quantileAttributes:
+      0.5: p50
+      0.99: p99
+`
+
+	c, err := ReadConfig([]byte(yaml))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[float64]string{0.5: "p50", 0.99: "p99"}, c.Metrics[0].QuantileAttributes)
+}
+
+func TestParseQueryTimeoutDefaults(t *testing.T) {
+	yaml := `
+version: 1.0
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+  timeout: 30s
+  maxTimeMS: 20000
+metrics:
+  - name: default_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+  - name: fast_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+    timeout: 2s
+    maxTimeMS: 1000
+`
+
+	c, err := ReadConfig([]byte(yaml))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, c.Metrics[0].Timeout)
+	assert.Equal(t, int64(20000), c.Metrics[0].MaxTimeMS)
+	assert.Equal(t, 2*time.Second, c.Metrics[1].Timeout)
+	assert.Equal(t, int64(1000), c.Metrics[1].MaxTimeMS)
+}
+
+func TestParseReadPreferenceDefaults(t *testing.T) {
+	yaml := `
+version: 1.0
+http:
+  port: 9090
+mongodb:
+  uri: mongodb://localhost:27017
+  readPreference:
+    mode: secondaryPreferred
+  readConcern: majority
+metrics:
+  - name: default_metric
+    db: testdb
+    collection: testcol
+    find: '{}'
+    metricsAttribute: count
+  - name: analytics_metric
+    db: testdb
+    collection: testcol
+    aggregate: '[]'
+    metricsAttribute: count
+    readPreference:
+      mode: secondary
+      tagSets:
+        - workload: analytics
+      maxStalenessSeconds: 120
+    readConcern: local
+  - name: command_metric
+    db: testdb
+    command: '{"dbStats": 1}'
+    metricsAttribute: objects
+`
+
+	c, err := ReadConfig([]byte(yaml))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ReadPreference{Mode: "secondaryPreferred"}, c.Metrics[0].ReadPreference)
+	assert.Equal(t, "majority", c.Metrics[0].ReadConcern)
+	assert.Equal(t, &ReadPreference{Mode: "secondary", TagSets: []map[string]string{{"workload": "analytics"}}, MaxStalenessSeconds: 120}, c.Metrics[1].ReadPreference)
+	assert.Equal(t, "local", c.Metrics[1].ReadConcern)
+	assert.Equal(t, &ReadPreference{Mode: "secondaryPreferred"}, c.Metrics[2].ReadPreference)
+	assert.Equal(t, "", c.Metrics[2].ReadConcern, "commands specify their read concern in the command document")
+}
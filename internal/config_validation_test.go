@@ -68,6 +68,15 @@ func TestValidateConfigStructure(t *testing.T) {
 			wantErr: true,
 			errMsg:  "at least one metric must be configured",
 		},
+		{
+			name: "builtin collectors without metrics",
+			config: Config{
+				HTTP:    HTTP{Port: 9090},
+				MongoDb: MongoDB{URI: "mongodb://localhost:27017"},
+				Builtin: Builtin{ServerStatus: true},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,6 +121,163 @@ func TestValidateMetric(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid counter metric",
+			metric: Metric{
+				Name:             "valid_metric_total",
+				Type:             MetricTypeCounter,
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid info metric without metricsAttribute",
+			metric: Metric{
+				Name:          "valid_metric_info",
+				Type:          MetricTypeInfo,
+				Db:            "testdb",
+				Collection:    "testcol",
+				Find:          "{}",
+				TagAttributes: map[string]string{"version": "version"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "info metric with metricsAttribute",
+			metric: Metric{
+				Name:             "invalid_metric_info",
+				Type:             MetricTypeInfo,
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "metricsAttribute is not supported for info metrics",
+		},
+		{
+			name: "valid info metric without tagAttributes",
+			metric: Metric{
+				Name:       "valid_metric_info",
+				Type:       MetricTypeInfo,
+				Db:         "testdb",
+				Collection: "testcol",
+				Find:       "{}",
+				Projection: `{"version": 1}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported metric type",
+			metric: Metric{
+				Name:             "test_metric",
+				Type:             "meter",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "unsupported metric type 'meter'",
+		},
+		{
+			name: "valid histogram metric",
+			metric: Metric{
+				Name:            "latency_seconds",
+				Type:            MetricTypeHistogram,
+				Db:              "testdb",
+				Collection:      "testcol",
+				Aggregate:       "[]",
+				BucketAttribute: "_id",
+				BucketBoundary:  BucketBoundaryLower,
+				CountAttribute:  "count",
+			},
+			wantErr: false,
+		},
+		{
+			name: "histogram without bucketAttribute",
+			metric: Metric{
+				Name:           "latency_seconds",
+				Type:           MetricTypeHistogram,
+				Db:             "testdb",
+				Collection:     "testcol",
+				Aggregate:      "[]",
+				CountAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "bucketAttribute cannot be empty",
+		},
+		{
+			name: "summary with invalid quantile",
+			metric: Metric{
+				Name:               "latency_seconds",
+				Type:               MetricTypeSummary,
+				Db:                 "testdb",
+				Collection:         "testcol",
+				Find:               "{}",
+				CountAttribute:     "count",
+				QuantileAttributes: map[float64]string{1.5: "p150"},
+			},
+			wantErr: true,
+			errMsg:  "quantile 1.5 must be between 0 and 1",
+		},
+		{
+			name: "valid metric with values",
+			metric: Metric{
+				Name:       "orders",
+				Db:         "testdb",
+				Collection: "testcol",
+				Aggregate:  "[]",
+				Values: []MetricValue{
+					{Attribute: "count", Suffix: "total", Type: MetricTypeCounter},
+					{Attribute: "max", Name: "orders_max_value"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "values and metricsAttribute",
+			metric: Metric{
+				Name:             "orders",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Aggregate:        "[]",
+				MetricsAttribute: "count",
+				Values:           []MetricValue{{Attribute: "count", Suffix: "total"}},
+			},
+			wantErr: true,
+			errMsg:  "cannot specify both 'metricsAttribute' and 'values'",
+		},
+		{
+			name: "values with duplicate names",
+			metric: Metric{
+				Name:       "orders",
+				Db:         "testdb",
+				Collection: "testcol",
+				Aggregate:  "[]",
+				Values: []MetricValue{
+					{Attribute: "count", Suffix: "total"},
+					{Attribute: "sum", Name: "orders_total"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "duplicate metric name 'orders_total'",
+		},
+		{
+			name: "value without name or suffix",
+			metric: Metric{
+				Name:       "orders",
+				Db:         "testdb",
+				Collection: "testcol",
+				Aggregate:  "[]",
+				Values:     []MetricValue{{Attribute: "count"}},
+			},
+			wantErr: true,
+			errMsg:  "either 'name' or 'suffix' must be specified",
+		},
 		{
 			name: "empty metric name",
 			metric: Metric{
@@ -147,10 +313,227 @@ func TestValidateMetric(t *testing.T) {
 				MetricsAttribute: "count",
 			},
 			wantErr: true,
-			errMsg:  "cannot specify both 'find' and 'aggregate'",
+			errMsg:  "only one of 'find', 'aggregate', 'command' and 'changeStream' queries can be specified",
+		},
+		{
+			name: "both find and command",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				Command:          `{"dbStats": 1}`,
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "only one of 'find', 'aggregate', 'command' and 'changeStream' queries can be specified",
+		},
+		{
+			name: "command without collection",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Command:          `{"dbStats": 1}`,
+				MetricsAttribute: "objects",
+			},
+			wantErr: false,
+		},
+		{
+			name: "change stream without collection",
+			metric: Metric{
+				Name:         "test_metric",
+				Db:           "testdb",
+				ChangeStream: "[]",
+			},
+			wantErr: false,
+		},
+		{
+			name: "change stream with metricsAttribute",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				ChangeStream:     "[]",
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "metricsAttribute and values are not supported for change streams",
+		},
+		{
+			name: "change stream gauge",
+			metric: Metric{
+				Name:         "test_metric",
+				Type:         MetricTypeGauge,
+				Db:           "testdb",
+				ChangeStream: "[]",
+			},
+			wantErr: true,
+			errMsg:  "change streams only support counter metrics",
+		},
+		{
+			name: "change stream with operation_type tag",
+			metric: Metric{
+				Name:          "test_metric",
+				Db:            "testdb",
+				ChangeStream:  "[]",
+				TagAttributes: map[string]string{"operation_type": "operationType"},
+			},
+			wantErr: true,
+			errMsg:  "tagAttributes cannot contain the label 'operation_type'",
+		},
+		{
+			name: "resume token file without change stream",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+				ResumeTokenFile:  "/var/lib/exporter/test.token",
+			},
+			wantErr: true,
+			errMsg:  "resumeTokenFile is only supported for change streams",
+		},
+		{
+			name: "invalid query template",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             `{"created": {"$gte": {{ now.Add "-5m" }`,
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "invalid query template",
+		},
+		{
+			name: "malformed find",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             `{"status": "open",, }`,
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: invalid query: invalid JSON at offset 19",
+		},
+		{
+			name: "aggregate without array",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Aggregate:        `{"$match": {}}`,
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: invalid query: query must be a JSON array",
+		},
+		{
+			name: "find options",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+				Projection:       `{"count": 1}`,
+				Sort:             `{"count": -1}`,
+				Limit:            1,
+				Hint:             "count_1",
+			},
+			wantErr: false,
+		},
+		{
+			name: "sort of an aggregate",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Aggregate:        "[]",
+				MetricsAttribute: "count",
+				Sort:             `{"count": -1}`,
+			},
+			wantErr: true,
+			errMsg:  "projection, sort, limit and skip are only supported for find queries",
+		},
+		{
+			name: "hint of a command",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Command:          `{"dbStats": 1}`,
+				MetricsAttribute: "objects",
+				Hint:             "count_1",
+			},
+			wantErr: true,
+			errMsg:  "hint, collation and batchSize are only supported for find and aggregate queries",
+		},
+		{
+			name: "negative limit",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+				Limit:            -1,
+			},
+			wantErr: true,
+			errMsg:  "limit, skip and batchSize cannot be negative",
+		},
+		{
+			name: "malformed projection",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+				Projection:       `{"count": }`,
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: invalid projection: invalid JSON at offset",
+		},
+		{
+			name: "read concern of a command",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Command:          `{"dbStats": 1}`,
+				MetricsAttribute: "objects",
+				ReadConcern:      "majority",
+			},
+			wantErr: true,
+			errMsg:  "readConcern is not supported for commands",
+		},
+		{
+			name: "invalid read preference",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Collection:       "testcol",
+				Find:             "{}",
+				MetricsAttribute: "count",
+				ReadPreference:   &ReadPreference{Mode: "secondary", MaxStalenessSeconds: 10},
+			},
+			wantErr: true,
+			errMsg:  "metric[0]: invalid readPreference: maxStalenessSeconds must be at least 90",
+		},
+		{
+			name: "find without collection",
+			metric: Metric{
+				Name:             "test_metric",
+				Db:               "testdb",
+				Find:             "{}",
+				MetricsAttribute: "count",
+			},
+			wantErr: true,
+			errMsg:  "collection name cannot be empty",
 		},
 		{
-			name: "neither find nor aggregate",
+			name: "no query",
 			metric: Metric{
 				Name:             "test_metric",
 				Db:               "testdb",
@@ -158,7 +541,7 @@ func TestValidateMetric(t *testing.T) {
 				MetricsAttribute: "count",
 			},
 			wantErr: true,
-			errMsg:  "either 'find' or 'aggregate' query must be specified",
+			errMsg:  "either 'find', 'aggregate', 'command' or 'changeStream' query must be specified",
 		},
 	}
 
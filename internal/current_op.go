@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var currentOpPipeline = mustParsePipeline(`[{"$currentOp": {"allUsers": true, "idleConnections": false}}, {"$match": {"active": true}}]`)
+
+// defaultCurrentOpThresholds are used if no thresholds are configured; 0s counts all active operations
+var defaultCurrentOpThresholds = []time.Duration{0, time.Second, 10 * time.Second, time.Minute}
+
+func validateCurrentOp(c CurrentOp) error {
+	// Equal thresholds, e.g. 1s and 1000ms, would export the same min_duration_seconds label twice
+	seen := make(map[time.Duration]int, len(c.Thresholds))
+	for i, threshold := range c.Thresholds {
+		if threshold < 0 {
+			return fmt.Errorf("thresholds[%d] cannot be negative", i)
+		}
+		if j, exists := seen[threshold]; exists {
+			return fmt.Errorf("thresholds[%d] duplicates thresholds[%d]", i, j)
+		}
+		seen[threshold] = i
+	}
+	return validateNamespaceFilter(c.Include, c.Exclude)
+}
+
+// currentOpKey groups the active operations
+type currentOpKey struct {
+	op        string
+	ns        string
+	threshold int
+}
+
+// currentOpCollector exports the active operations of the target reported by $currentOp
+type currentOpCollector struct {
+	*commandRunner
+	thresholds []time.Duration
+	filter     namespaceFilter
+	operations *prometheus.Desc
+	oldest     *prometheus.Desc
+}
+
+// NewCurrentOpCollector creates a collector counting the active operations of the given target by type, namespace
+// and duration threshold and exporting the running time of the oldest operation
+func NewCurrentOpCollector(c CurrentOp, t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) BuiltinCollector {
+	thresholds := append([]time.Duration(nil), c.Thresholds...)
+	if len(thresholds) == 0 {
+		thresholds = defaultCurrentOpThresholds
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+
+	return &currentOpCollector{
+		commandRunner: newCommandRunner("currentOp", t.Name, timeout, con, errorC, metrics),
+		thresholds:    thresholds,
+		filter:        newNamespaceFilter(c.Include, c.Exclude),
+		operations: prometheus.NewDesc("mongodb_current_operations",
+			"Number of active operations running at least min_duration_seconds by operation type and namespace",
+			[]string{"op", "ns", "min_duration_seconds"}, t.ConstLabels()),
+		oldest: prometheus.NewDesc("mongodb_current_operation_oldest_age_seconds",
+			"Running time of the oldest active operation in seconds", nil, t.ConstLabels()),
+	}
+}
+
+// Describe writes the descriptors of the operation metrics
+func (c *currentOpCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.operations
+	ch <- c.oldest
+}
+
+// Collect runs $currentOp and counts the active operations matching the namespace filter
+func (c *currentOpCollector) Collect(ch chan<- prometheus.Metric) {
+	ops, ok := c.aggregate("admin", "", currentOpPipeline)
+	if !ok {
+		return
+	}
+
+	counts := make(map[currentOpKey]int)
+	oldest := 0.0
+	for _, op := range ops {
+		// Skip the $currentOp aggregation of this collector
+		if _, err := lookupPath(op, "command.pipeline.0.$currentOp"); err == nil {
+			continue
+		}
+		ns, _ := op["ns"].(string)
+		if !c.filter.matches(ns) {
+			continue
+		}
+		running, ok := runningSeconds(op)
+		if !ok {
+			continue
+		}
+		if running > oldest {
+			oldest = running
+		}
+		opType, _ := op["op"].(string)
+		for i, threshold := range c.thresholds {
+			if running >= threshold.Seconds() {
+				counts[currentOpKey{op: opType, ns: ns, threshold: i}]++
+			}
+		}
+	}
+
+	for key, count := range counts {
+		threshold := strconv.FormatFloat(c.thresholds[key.threshold].Seconds(), 'f', -1, 64)
+		ch <- prometheus.MustNewConstMetric(c.operations, prometheus.GaugeValue, float64(count), key.op, key.ns, threshold)
+	}
+	ch <- prometheus.MustNewConstMetric(c.oldest, prometheus.GaugeValue, oldest)
+}
+
+// runningSeconds returns the running time of the operation, preferring the precise microsecs_running
+func runningSeconds(op bson.M) (float64, bool) {
+	if micros, err := extractNumber(op, "microsecs_running", "currentOp"); err == nil {
+		return micros / 1e6, true
+	}
+	if secs, err := extractNumber(op, "secs_running", "currentOp"); err == nil {
+		return secs, true
+	}
+	return 0, false
+}
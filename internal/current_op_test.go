@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func operation(op string, ns string, running time.Duration) bson.M {
+	return bson.M{"op": op, "ns": ns, "active": true, "microsecs_running": running.Microseconds()}
+}
+
+func TestCurrentOpCollector(t *testing.T) {
+	t.Run("counts the active operations by threshold", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		onAggregate(con, "admin", "", currentOpPipeline,
+			operation("query", "shop.orders", 500*time.Millisecond),
+			operation("query", "shop.orders", 90*time.Second),
+			operation("update", "shop.customers", 2*time.Second),
+			operation("command", "metrics.stats", time.Hour),
+			bson.M{"op": "command", "ns": "admin.$cmd.aggregate", "secs_running": int64(0),
+				"command": bson.M{"aggregate": int32(1), "pipeline": primitive.A{bson.M{"$currentOp": bson.M{}}}}},
+		)
+		config := CurrentOp{Thresholds: []time.Duration{time.Minute, time.Second}, Exclude: `^metrics\.`}
+
+		c := NewCurrentOpCollector(config, Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_current_operation_oldest_age_seconds Running time of the oldest active operation in seconds
+# TYPE mongodb_current_operation_oldest_age_seconds gauge
+mongodb_current_operation_oldest_age_seconds 90
+# HELP mongodb_current_operations Number of active operations running at least min_duration_seconds by operation type and namespace
+# TYPE mongodb_current_operations gauge
+mongodb_current_operations{min_duration_seconds="1",ns="shop.customers",op="update"} 1
+mongodb_current_operations{min_duration_seconds="1",ns="shop.orders",op="query"} 1
+mongodb_current_operations{min_duration_seconds="60",ns="shop.orders",op="query"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("counts all active operations by default", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		onAggregate(con, "admin", "", currentOpPipeline, operation("query", "shop.orders", 500*time.Millisecond))
+
+		c := NewCurrentOpCollector(CurrentOp{}, Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_current_operations Number of active operations running at least min_duration_seconds by operation type and namespace
+# TYPE mongodb_current_operations gauge
+mongodb_current_operations{min_duration_seconds="0",ns="shop.orders",op="query"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "mongodb_current_operations"))
+	})
+
+	t.Run("reports aggregations failed by the connection", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		con.On("Aggregate", mock.Anything, "admin", "", currentOpPipeline, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+		errorC := make(chan error, 1)
+
+		c := NewCurrentOpCollector(CurrentOp{}, Target{}, 0, con, errorC, testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+	})
+}
+
+func TestValidateCurrentOp(t *testing.T) {
+	assert.NoError(t, validateCurrentOp(CurrentOp{Thresholds: []time.Duration{0, time.Second}}))
+	assert.ErrorContains(t, validateCurrentOp(CurrentOp{Thresholds: []time.Duration{-time.Second}}), "thresholds[0] cannot be negative")
+	assert.ErrorContains(t, validateCurrentOp(CurrentOp{Thresholds: []time.Duration{time.Second, 0, 1000 * time.Millisecond}}), "thresholds[2] duplicates thresholds[0]")
+	assert.ErrorContains(t, validateCurrentOp(CurrentOp{Include: `(`}), "invalid include")
+}
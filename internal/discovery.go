@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// defaultRefreshInterval is used if no refresh interval of the discovered collections is configured
+const defaultRefreshInterval = 5 * time.Minute
+
+var (
+	listDatabasesCommand  = mustParseDocument(`{"listDatabases": 1, "nameOnly": true}`)
+	listCollectionsFilter = mustParseDocument(`{"type": "collection"}`)
+)
+
+// systemDatabases are never discovered
+var systemDatabases = map[string]bool{"admin": true, "config": true, "local": true}
+
+func validateDiscovery(c Discovery) error {
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refreshInterval cannot be negative")
+	}
+	for i, collection := range c.Collections {
+		if _, err := parseNamespace(collection); err != nil {
+			return fmt.Errorf("collections[%d]: %w", i, err)
+		}
+	}
+	return validateNamespaceFilter(c.Include, c.Exclude)
+}
+
+func validateNamespaceFilter(include string, exclude string) error {
+	if _, err := regexp.Compile(include); err != nil {
+		return fmt.Errorf("invalid include: %w", err)
+	}
+	if _, err := regexp.Compile(exclude); err != nil {
+		return fmt.Errorf("invalid exclude: %w", err)
+	}
+	return nil
+}
+
+// namespace identifies a collection
+type namespace struct {
+	db         string
+	collection string
+}
+
+// parseNamespace splits a namespace "db.collection"; the collection name may contain dots
+func parseNamespace(ns string) (namespace, error) {
+	parts := strings.SplitN(ns, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return namespace{}, fmt.Errorf("invalid namespace '%s', expected 'db.collection'", ns)
+	}
+	return namespace{db: parts[0], collection: parts[1]}, nil
+}
+
+func (ns namespace) String() string {
+	return ns.db + "." + ns.collection
+}
+
+// collectionDiscovery lists the collections of a target, which match the filters of a Discovery
+// The discovered collections are cached for the refresh interval.
+type collectionDiscovery struct {
+	runner          *commandRunner
+	configured      []namespace
+	filter          namespaceFilter
+	refreshInterval time.Duration
+	namespaces      []namespace
+	lastDiscovery   time.Time
+	mu              sync.Mutex
+}
+
+func newCollectionDiscovery(c Discovery, runner *commandRunner) *collectionDiscovery {
+	d := &collectionDiscovery{
+		runner:          runner,
+		filter:          newNamespaceFilter(c.Include, c.Exclude),
+		refreshInterval: c.RefreshInterval,
+	}
+	if d.refreshInterval <= 0 {
+		d.refreshInterval = defaultRefreshInterval
+	}
+	// The config is validated before
+	for _, collection := range c.Collections {
+		ns, _ := parseNamespace(collection)
+		d.configured = append(d.configured, ns)
+	}
+	return d
+}
+
+// collections returns the configured collections or otherwise the discovered ones,
+// which are listed again after the refresh interval
+func (d *collectionDiscovery) collections() ([]namespace, bool) {
+	if len(d.configured) > 0 {
+		return d.configured, true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.lastDiscovery.IsZero() && time.Since(d.lastDiscovery) < d.refreshInterval {
+		return d.namespaces, true
+	}
+	namespaces, ok := d.discover()
+	if !ok {
+		return nil, false
+	}
+	d.namespaces = namespaces
+	d.lastDiscovery = time.Now()
+	return namespaces, true
+}
+
+// reset lets the next call of collections discover again, e.g. after a collection was dropped
+func (d *collectionDiscovery) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastDiscovery = time.Time{}
+}
+
+func (d *collectionDiscovery) discover() ([]namespace, bool) {
+	result, ok := d.runner.run("admin", listDatabasesCommand)
+	if !ok {
+		return nil, false
+	}
+	databases, err := lookupDocuments(result, "databases")
+	if err != nil {
+		d.runner.fail("admin", "", extractErrorType(err, "invalid_result"), fmt.Errorf("listDatabases returned no databases: %w", err))
+		return nil, false
+	}
+
+	namespaces := make([]namespace, 0)
+	for _, database := range databases {
+		db, _ := database["name"].(string)
+		if db == "" || systemDatabases[db] {
+			continue
+		}
+		collections, ok := d.runner.listCollectionNames(db, listCollectionsFilter)
+		if !ok {
+			return nil, false
+		}
+		for _, name := range collections {
+			ns := namespace{db: db, collection: name}
+			if name == "" || strings.HasPrefix(name, "system.") || !d.filter.matches(ns.String()) {
+				continue
+			}
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, true
+}
+
+// namespaceFilter selects namespaces by the include and exclude regular expressions of the config
+type namespaceFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// newNamespaceFilter compiles the given expressions, which are validated with the config; empty expressions are ignored
+func newNamespaceFilter(include string, exclude string) namespaceFilter {
+	var f namespaceFilter
+	if include != "" {
+		f.include = regexp.MustCompile(include)
+	}
+	if exclude != "" {
+		f.exclude = regexp.MustCompile(exclude)
+	}
+	return f
+}
+
+func (f namespaceFilter) matches(ns string) bool {
+	if f.include != nil && !f.include.MatchString(ns) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(ns)
+}
+
+// discoveredCollector runs a pipeline on every collection of a discovery and exports the results
+// through the emission path of a Collector
+type discoveredCollector struct {
+	*commandRunner
+	discovery *collectionDiscovery
+	collector *Collector
+	pipeline  driverbson.A
+	// toResults maps the pipeline results of a collection to the result documents of the collector
+	toResults func(ns namespace, results []bson.M) []bson.M
+}
+
+func newDiscoveredCollector(name string, c Discovery, m Metric, pipeline driverbson.A, toResults func(namespace, []bson.M) []bson.M,
+	t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) *discoveredCollector {
+	m.Tags = t.ConstLabels()
+	runner := newCommandRunner(name, t.Name, timeout, con, errorC, metrics)
+	return &discoveredCollector{
+		commandRunner: runner,
+		discovery:     newCollectionDiscovery(c, runner),
+		collector:     NewCollector(m, nil, nil, metrics),
+		pipeline:      pipeline,
+		toResults:     toResults,
+	}
+}
+
+// Describe writes the descriptors of the collector
+func (c *discoveredCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Collect runs the pipeline for every collection
+func (c *discoveredCollector) Collect(ch chan<- prometheus.Metric) {
+	namespaces, ok := c.discovery.collections()
+	if !ok {
+		return
+	}
+
+	results := make([]bson.M, 0, len(namespaces))
+	for _, ns := range namespaces {
+		docs, ok := c.aggregate(ns.db, ns.collection, c.pipeline)
+		if !ok {
+			// The collection may have been dropped
+			c.discovery.reset()
+			continue
+		}
+		results = append(results, c.toResults(ns, docs)...)
+	}
+
+	metrics, errorType, err := c.collector.buildMetrics(results)
+	if err != nil {
+		c.fail("", "", errorType, err)
+		return
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+}
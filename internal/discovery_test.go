@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestValidateDiscovery(t *testing.T) {
+	assert.NoError(t, validateDiscovery(Discovery{Include: `^shop\.`, Collections: []string{"shop.orders.archive"}}))
+	assert.ErrorContains(t, validateDiscovery(Discovery{Include: `(`}), "invalid include")
+	assert.ErrorContains(t, validateDiscovery(Discovery{Exclude: `[`}), "invalid exclude")
+	assert.ErrorContains(t, validateDiscovery(Discovery{RefreshInterval: -1}), "refreshInterval cannot be negative")
+	assert.ErrorContains(t, validateDiscovery(Discovery{Collections: []string{"orders"}}), "collections[0]: invalid namespace 'orders'")
+}
+
+func TestCollectionDiscovery(t *testing.T) {
+	t.Run("uses the configured collections without discovery", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		d := newCollectionDiscovery(Discovery{Collections: []string{"shop.orders", "shop.orders.archive"}},
+			newCommandRunner("test", "", 0, con, make(chan error, 1), testMetrics()))
+
+		namespaces, ok := d.collections()
+
+		assert.True(t, ok)
+		assert.Equal(t, []namespace{{db: "shop", collection: "orders"}, {db: "shop", collection: "orders.archive"}}, namespaces)
+		con.AssertNotCalled(t, "RunCommand", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("discovers again after a reset", func(t *testing.T) {
+		con := collStatsMock()
+		d := newCollectionDiscovery(Discovery{}, newCommandRunner("test", "", 0, con, make(chan error, 1), testMetrics()))
+
+		namespaces, ok := d.collections()
+		assert.True(t, ok)
+		assert.Equal(t, []namespace{{db: "shop", collection: "orders"}, {db: "shop", collection: "customers"}, {db: "logs", collection: "events"}}, namespaces)
+
+		d.reset()
+		_, ok = d.collections()
+		assert.True(t, ok)
+		con.AssertNumberOfCalls(t, "RunCommand", 2)
+		con.AssertNumberOfCalls(t, "ListCollectionNames", 4)
+	})
+
+	t.Run("discovers databases with more collections than the first batch", func(t *testing.T) {
+		names := make([]string, 0, 150)
+		for i := 0; i < 150; i++ {
+			names = append(names, fmt.Sprintf("events_%03d", i))
+		}
+		con := &mocks.IConnection{}
+		onCommand(con, "admin", listDatabasesCommand, bson.M{"databases": primitive.A{bson.M{"name": "logs"}}})
+		con.On("ListCollectionNames", mock.Anything, "logs", listCollectionsFilter).Return(names, nil)
+		d := newCollectionDiscovery(Discovery{}, newCommandRunner("test", "", 0, con, make(chan error, 1), testMetrics()))
+
+		namespaces, ok := d.collections()
+
+		assert.True(t, ok)
+		assert.Len(t, namespaces, 150)
+		assert.Equal(t, namespace{db: "logs", collection: "events_149"}, namespaces[149])
+	})
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Supported values of Metric.BucketBoundary
+const (
+	BucketBoundaryUpper = "upper"
+	BucketBoundaryLower = "lower"
+)
+
+// histogramBucket is a single bucket document of a pre-bucketed aggregation result
+type histogramBucket struct {
+	boundary float64
+	count    float64
+}
+
+// histogramSeries collects all bucket documents sharing the same tag values
+type histogramSeries struct {
+	tagValues []string
+	buckets   []histogramBucket
+	count     float64
+	sum       float64
+}
+
+// buildHistograms merges the bucket documents of the query result into one const histogram per tag value combination
+func (col *Collector) buildHistograms(results []bson.M) ([]prometheus.Metric, string, error) {
+	series := make(map[string]*histogramSeries)
+	order := make([]string, 0)
+
+	for _, result := range results {
+		tagValues, err := col.extractVarTagsValues(result)
+		if err != nil {
+			return nil, extractErrorType(err, "extract_tags_failed"), err
+		}
+		key := strings.Join(tagValues, "\xff")
+		s, exists := series[key]
+		if !exists {
+			s = &histogramSeries{tagValues: tagValues}
+			series[key] = s
+			order = append(order, key)
+		}
+
+		count, err := extractNumber(result, col.config.CountAttribute, "count")
+		if err != nil {
+			return nil, extractErrorType(err, "extract_value_failed"), err
+		}
+		s.count += count
+
+		if col.config.SumAttribute != "" {
+			sum, err := extractNumber(result, col.config.SumAttribute, "sum")
+			if err != nil {
+				return nil, extractErrorType(err, "extract_value_failed"), err
+			}
+			s.sum += sum
+		}
+
+		// Non numeric boundaries, e.g. the default bucket of $bucket, only contribute to the total count
+		boundary, err := extractNumber(result, col.config.BucketAttribute, "bucket")
+		if err != nil {
+			var pathErr *PathError
+			if errors.As(err, &pathErr) {
+				return nil, string(pathErr.Kind), err
+			}
+			continue
+		}
+		s.buckets = append(s.buckets, histogramBucket{boundary: boundary, count: count})
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(order))
+	for _, key := range order {
+		s := series[key]
+		metrics = append(metrics, prometheus.MustNewConstHistogram(col.desc, uint64(s.count), s.sum, s.cumulativeBuckets(col.config.BucketBoundary), s.tagValues...))
+	}
+	return metrics, "", nil
+}
+
+// cumulativeBuckets converts the per bucket counts into the cumulative upper bound buckets prometheus expects.
+// With lower boundaries (as produced by $bucket) every bucket ends at the boundary of its successor,
+// the last bucket ends at +Inf and is therefore only part of the total count.
+func (s *histogramSeries) cumulativeBuckets(boundary string) map[float64]uint64 {
+	sort.Slice(s.buckets, func(i, j int) bool {
+		return s.buckets[i].boundary < s.buckets[j].boundary
+	})
+
+	buckets := make(map[float64]uint64, len(s.buckets))
+	cumulative := 0.0
+	for i, b := range s.buckets {
+		upperBound := b.boundary
+		if boundary == BucketBoundaryLower {
+			if i+1 >= len(s.buckets) {
+				break
+			}
+			upperBound = s.buckets[i+1].boundary
+		}
+		cumulative += b.count
+		if !math.IsInf(upperBound, 1) {
+			buckets[upperBound] = uint64(cumulative)
+		}
+	}
+	return buckets
+}
+
+// buildSummaries creates one const summary per result document
+func (col *Collector) buildSummaries(results []bson.M) ([]prometheus.Metric, string, error) {
+	metrics := make([]prometheus.Metric, 0, len(results))
+	for _, result := range results {
+		tagValues, err := col.extractVarTagsValues(result)
+		if err != nil {
+			return nil, extractErrorType(err, "extract_tags_failed"), err
+		}
+
+		count, err := extractNumber(result, col.config.CountAttribute, "count")
+		if err != nil {
+			return nil, extractErrorType(err, "extract_value_failed"), err
+		}
+
+		sum := 0.0
+		if col.config.SumAttribute != "" {
+			if sum, err = extractNumber(result, col.config.SumAttribute, "sum"); err != nil {
+				return nil, extractErrorType(err, "extract_value_failed"), err
+			}
+		}
+
+		quantiles := make(map[float64]float64, len(col.config.QuantileAttributes))
+		for quantile, attribute := range col.config.QuantileAttributes {
+			value, err := extractNumber(result, attribute, fmt.Sprintf("quantile %v", quantile))
+			if err != nil {
+				return nil, extractErrorType(err, "extract_value_failed"), err
+			}
+			quantiles[quantile] = value
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstSummary(col.desc, uint64(count), sum, quantiles, tagValues...))
+	}
+	return metrics, "", nil
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCollectHistogram(t *testing.T) {
+	t.Run("upper boundaries are accumulated per tag value", func(t *testing.T) {
+		metric := Metric{
+			Name:            "latency_seconds",
+			Type:            MetricTypeHistogram,
+			Db:              "myDB",
+			Collection:      "myCollection",
+			Find:            "{}",
+			BucketAttribute: "le",
+			CountAttribute:  "count",
+			SumAttribute:    "sum",
+			TagAttributes:   map[string]string{"service": "service"},
+		}
+		docs := []bson.M{
+			{"service": "a", "le": 0.5, "count": int32(2), "sum": 0.6},
+			{"service": "a", "le": 0.1, "count": int32(3), "sum": 0.2},
+			{"service": "a", "le": "+Inf", "count": int32(1), "sum": 2.0},
+			{"service": "b", "le": 0.1, "count": int32(4), "sum": 0.3},
+		}
+
+		c := NewCollector(metric, findMock(metric, docs...), make(chan error, 1), testMetrics())
+		ch := make(chan prometheus.Metric, 2)
+		c.Collect(ch)
+
+		assert.Equal(t, 2, len(ch))
+		a := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(a))
+		assert.Equal(t, uint64(6), a.GetHistogram().GetSampleCount())
+		assert.InDelta(t, 2.8, a.GetHistogram().GetSampleSum(), 0.0001)
+		assert.Equal(t, 2, len(a.GetHistogram().GetBucket()))
+		assert.Equal(t, 0.1, a.GetHistogram().GetBucket()[0].GetUpperBound())
+		assert.Equal(t, uint64(3), a.GetHistogram().GetBucket()[0].GetCumulativeCount())
+		assert.Equal(t, 0.5, a.GetHistogram().GetBucket()[1].GetUpperBound())
+		assert.Equal(t, uint64(5), a.GetHistogram().GetBucket()[1].GetCumulativeCount())
+
+		b := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(b))
+		assert.Equal(t, uint64(4), b.GetHistogram().GetSampleCount())
+	})
+
+	t.Run("lower boundaries of $bucket end at the next boundary", func(t *testing.T) {
+		metric := Metric{
+			Name:            "latency_seconds",
+			Type:            MetricTypeHistogram,
+			Db:              "myDB",
+			Collection:      "myCollection",
+			Find:            "{}",
+			BucketAttribute: "_id",
+			BucketBoundary:  BucketBoundaryLower,
+			CountAttribute:  "count",
+		}
+		docs := []bson.M{
+			{"_id": int32(0), "count": int32(1)},
+			{"_id": int32(10), "count": int32(2)},
+			{"_id": int32(100), "count": int32(4)},
+			{"_id": "Other", "count": int32(8)},
+		}
+
+		c := NewCollector(metric, findMock(metric, docs...), make(chan error, 1), testMetrics())
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+
+		out := &dto.Metric{}
+		assert.NoError(t, (<-ch).Write(out))
+		assert.Equal(t, uint64(15), out.GetHistogram().GetSampleCount())
+		buckets := out.GetHistogram().GetBucket()
+		assert.Equal(t, 2, len(buckets))
+		assert.Equal(t, 10.0, buckets[0].GetUpperBound())
+		assert.Equal(t, uint64(1), buckets[0].GetCumulativeCount())
+		assert.Equal(t, 100.0, buckets[1].GetUpperBound())
+		assert.Equal(t, uint64(3), buckets[1].GetCumulativeCount())
+	})
+
+	t.Run("missing count attribute is reported", func(t *testing.T) {
+		metric := Metric{
+			Name:            "latency_seconds",
+			Type:            MetricTypeHistogram,
+			Db:              "myDB",
+			Collection:      "myCollection",
+			Find:            "{}",
+			BucketAttribute: "le",
+			CountAttribute:  "count",
+		}
+		errorC := make(chan error, 1)
+		metrics := testMetrics()
+
+		c := NewCollector(metric, findMock(metric, bson.M{"le": 1.0}), errorC, metrics)
+		ch := make(chan prometheus.Metric, 1)
+		c.Collect(ch)
+
+		assert.Equal(t, 0, len(ch))
+		assert.Empty(t, errorC)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("", "latency_seconds", "myDB", "myCollection", "path_not_found")))
+	})
+}
+
+func TestCollectSummary(t *testing.T) {
+	metric := Metric{
+		Name:               "latency_seconds",
+		Type:               MetricTypeSummary,
+		Db:                 "myDB",
+		Collection:         "myCollection",
+		Find:               "{}",
+		CountAttribute:     "count",
+		SumAttribute:       "total",
+		QuantileAttributes: map[float64]string{0.5: "p50", 0.99: "p99"},
+	}
+	doc := bson.M{"count": int64(10), "total": 4.2, "p50": 0.3, "p99": int32(1)}
+
+	c := NewCollector(metric, findMock(metric, doc), make(chan error, 1), testMetrics())
+	ch := make(chan prometheus.Metric, 1)
+	c.Collect(ch)
+
+	out := &dto.Metric{}
+	assert.NoError(t, (<-ch).Write(out))
+	assert.Equal(t, uint64(10), out.GetSummary().GetSampleCount())
+	assert.Equal(t, 4.2, out.GetSummary().GetSampleSum())
+	assert.Equal(t, 2, len(out.GetSummary().GetQuantile()))
+	assert.Equal(t, 0.5, out.GetSummary().GetQuantile()[0].GetQuantile())
+	assert.Equal(t, 0.3, out.GetSummary().GetQuantile()[0].GetValue())
+	assert.Equal(t, 1.0, out.GetSummary().GetQuantile()[1].GetValue())
+}
@@ -15,25 +15,40 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// RegisterHealthChecks creates and registers a MongoDB health check.
+// RegisterHealthChecks creates and registers a MongoDB health check for every given target.
 // It returns an http.HandlerFunc that serves the health status in JSON.
-func RegisterHealthChecks(mongoURI string) (netHttp.HandlerFunc, error) {
+func RegisterHealthChecks(targets []Target) (netHttp.HandlerFunc, error) {
+	// Create gosundheit instance
+	h := gosundheit.New()
+
+	for _, target := range targets {
+		if err := registerTargetHealthCheck(h, target); err != nil {
+			return nil, err
+		}
+	}
+
+	return healthHttp.HandleHealthJSON(h), nil
+}
+
+func registerTargetHealthCheck(h gosundheit.Health, target Target) error {
 	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	clientOpts := options.Client().ApplyURI(mongoURI)
+	clientOpts := options.Client().ApplyURI(target.URI)
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
-	// Create gosundheit instance
-	h := gosundheit.New()
+	checkName := "mongodb.ping"
+	if target.Name != "" {
+		checkName = fmt.Sprintf("mongodb.%s.ping", target.Name)
+	}
 
 	// Create MongoDB ping check
 	mongoCheck := &checks.CustomCheck{
-		CheckName: "mongodb.ping",
+		CheckName: checkName,
 		CheckFunc: func(ctx context.Context) (interface{}, error) {
 			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 			defer cancel()
@@ -48,8 +63,7 @@ func RegisterHealthChecks(mongoURI string) (netHttp.HandlerFunc, error) {
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to register MongoDB health check: %w", err)
+		return fmt.Errorf("failed to register MongoDB health check: %w", err)
 	}
-
-	return healthHttp.HandleHealthJSON(h), nil
+	return nil
 }
@@ -11,7 +11,7 @@ import (
 func TestMongoHealthCheck(t *testing.T) {
 
 	t.Run("returns handler when MongoDB URI is valid", func(t *testing.T) {
-		handler, err := RegisterHealthChecks("mongodb://localhost:27017")
+		handler, err := RegisterHealthChecks([]Target{{URI: "mongodb://localhost:27017"}})
 		assert.NoError(t, err)
 		assert.NotNil(t, handler)
 		
@@ -31,14 +31,14 @@ func TestMongoHealthCheck(t *testing.T) {
 	})
 
 	t.Run("returns error when MongoDB URI is invalid", func(t *testing.T) {
-		handler, err := RegisterHealthChecks("invalid-uri")
+		handler, err := RegisterHealthChecks([]Target{{URI: "invalid-uri"}})
 		assert.Error(t, err)
 		assert.Nil(t, handler)
 		assert.Contains(t, err.Error(), "failed to connect to MongoDB")
 	})
 
 	t.Run("returns handler for unreachable MongoDB host", func(t *testing.T) {
-		handler, err := RegisterHealthChecks("mongodb://localhost:27999")
+		handler, err := RegisterHealthChecks([]Target{{URI: "mongodb://localhost:27999"}})
 		assert.NoError(t, err)
 		assert.NotNil(t, handler)
 		
@@ -2,53 +2,133 @@ package internal
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	netHttp "net/http"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // HttpServer serves endpoints from the given Config
 type HttpServer struct {
-	Port   int
-	config Config
-	server *netHttp.Server
+	Port        int
+	config      Config
+	server      *netHttp.Server
+	mux         *netHttp.ServeMux
+	registry    *prometheus.Registry
+	gatherers   prometheus.Gatherers
+	configs     func() Config
+	connections ConnectionProvider
+	metrics     *Metrics
+	reload      func() error
+	auth        *authenticator
+	errC        chan error
 }
 
-// NewHttpServer creates a new instance of the HttpServer
-func NewHttpServer(config Config) *HttpServer {
+// NewHttpServer creates a new instance of the HttpServer, which serves the metrics of the given registry
+func NewHttpServer(config Config, registry *prometheus.Registry) *HttpServer {
 	return &HttpServer{
-		config: config,
+		config:    config,
+		mux:       netHttp.NewServeMux(),
+		registry:  registry,
+		gatherers: prometheus.Gatherers{registry},
 	}
 }
 
-// Start the HTTP server
-// Returns a WaitGroup which will be released as soon as the server stops
-func (s *HttpServer) Start(wg *sync.WaitGroup) {
-	if err := registerHealthHandler(s.config.HTTP.Health, s.config.MongoDb.URI); err != nil {
-		log.Fatal(err.Error())
-	}
-	registerLivelinessHandler(s.config.HTTP.Liveliness)
-	registerPrometheusHandler(s.config.HTTP.Prometheus)
+// AddGatherer serves the metrics of the given gatherer on the prometheus endpoint in addition to the registry ones
+func (s *HttpServer) AddGatherer(g prometheus.Gatherer) {
+	s.gatherers = append(s.gatherers, g)
+}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.HTTP.Port))
+// EnableProbe serves the probe endpoint, if configured, using the current config and the connections of the given providers
+func (s *HttpServer) EnableProbe(configs func() Config, connections ConnectionProvider, metrics *Metrics) {
+	s.configs = configs
+	s.connections = connections
+	s.metrics = metrics
+}
+
+// EnableReload serves the reload endpoint, if configured, which triggers the given reload function
+func (s *HttpServer) EnableReload(reload func() error) {
+	s.reload = reload
+}
+
+// Start the HTTP server
+// The given WaitGroup is released as soon as the server stops, or at once if it cannot be started. Errors of the
+// running server are sent to the Errors channel.
+func (s *HttpServer) Start(wg *sync.WaitGroup) error {
+	listener, reloader, err := s.listen()
 	if err != nil {
-		log.Fatal(err.Error())
+		wg.Done()
+		return err
+	}
+	s.server = &netHttp.Server{Handler: s.mux}
+	s.errC = make(chan error, 1)
+	done := make(chan struct{})
+	if reloader != nil {
+		go reloader.watch(tlsReloadInterval, done)
 	}
-	s.Port = listener.Addr().(*net.TCPAddr).Port
-	s.server = &netHttp.Server{}
 
 	go func() {
 		defer wg.Done()
+		defer close(done)
 		defer log.Info("Stopping server")
 		log.Info(fmt.Sprintf("Serving endpoint on port: %v", s.Port))
 		if err := s.server.Serve(listener); !errors.Is(err, netHttp.ErrServerClosed) {
-			log.Fatal(fmt.Sprintf("ListenAndServe(): %v", err))
+			s.errC <- fmt.Errorf("http server failed: %w", err)
 		}
 	}()
+	return nil
+}
+
+// listen registers the configured endpoints and opens the listener of the server
+func (s *HttpServer) listen() (net.Listener, *tlsReloader, error) {
+	if s.config.HTTP.Auth != nil {
+		auth, err := newAuthenticator(*s.config.HTTP.Auth)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.auth = auth
+	}
+	var reloader *tlsReloader
+	if s.config.HTTP.TLS != nil {
+		var err error
+		if reloader, err = newTLSReloader(*s.config.HTTP.TLS); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	health, err := healthHandler(s.config.MongoTargets())
+	if err != nil {
+		return nil, nil, err
+	}
+	s.handle(EndpointHealth, s.config.HTTP.Health, health)
+	s.handle(EndpointLiveliness, s.config.HTTP.Liveliness, livelinessHandler())
+	s.handle(EndpointPrometheus, s.config.HTTP.Prometheus, prometheusHandler(s.registry, s.gatherers))
+	if s.config.HTTP.Probe != "" && s.connections != nil {
+		s.handle(EndpointProbe, s.config.HTTP.Probe, NewProbeHandler(s.configs, s.connections, s.metrics))
+	}
+	if s.config.HTTP.Reload != "" && s.reload != nil {
+		s.handle(EndpointReload, s.config.HTTP.Reload, reloadHandler(s.reload))
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.HTTP.Port))
+	if err != nil {
+		return nil, nil, err
+	}
+	s.Port = listener.Addr().(*net.TCPAddr).Port
+	if reloader != nil {
+		listener = tls.NewListener(listener, &tls.Config{GetConfigForClient: reloader.configForClient})
+	}
+	return listener, reloader, nil
+}
+
+// Errors returns the channel of the running server, which receives an error if the server fails
+func (s *HttpServer) Errors() <-chan error {
+	return s.errC
 }
 
 // Shutdown stops the running server
@@ -56,21 +136,38 @@ func (s *HttpServer) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
-func registerHealthHandler(path string, mongoUri string) error {
-	handler, err := RegisterHealthChecks(mongoUri)
-	if err != nil {
-		return err
-	}
-	netHttp.Handle(path, handler)
-	return nil
+// handle serves the handler of the named endpoint on the given path, requiring authentication if configured
+func (s *HttpServer) handle(endpoint string, path string, handler netHttp.Handler) {
+	s.mux.Handle(path, s.auth.protect(endpoint, handler))
+}
+
+func healthHandler(targets []Target) (netHttp.Handler, error) {
+	return RegisterHealthChecks(targets)
 }
 
-func registerLivelinessHandler(path string) {
-	netHttp.HandleFunc(path, func(w netHttp.ResponseWriter, request *netHttp.Request) {
+func livelinessHandler() netHttp.Handler {
+	return netHttp.HandlerFunc(func(w netHttp.ResponseWriter, request *netHttp.Request) {
 		w.WriteHeader(204)
 	})
 }
 
-func registerPrometheusHandler(path string) {
-	netHttp.Handle(path, promhttp.Handler())
+func prometheusHandler(registry *prometheus.Registry, gatherers prometheus.Gatherers) netHttp.Handler {
+	return promhttp.InstrumentMetricHandler(
+		registry, promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}),
+	)
+}
+
+func reloadHandler(reload func() error) netHttp.Handler {
+	return netHttp.HandlerFunc(func(w netHttp.ResponseWriter, request *netHttp.Request) {
+		if request.Method != netHttp.MethodPost {
+			w.Header().Set("Allow", netHttp.MethodPost)
+			netHttp.Error(w, "Only POST requests allowed", netHttp.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			netHttp.Error(w, err.Error(), netHttp.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(200)
+	})
 }
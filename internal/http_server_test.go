@@ -3,11 +3,13 @@ package internal
 import (
 	"context"
 	"fmt"
+	"net"
 	httpClient "net/http"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,13 +20,19 @@ func TestHttpServer(t *testing.T) {
 			Prometheus: "/metrics",
 			Health:     "/health",
 			Liveliness: "/live",
+			Reload:     "/-/reload",
 		},
 		MongoDb: MongoDB{URI: "mongodb://localhost:27017"},
+	}, prometheus.NewRegistry())
+	reloads := 0
+	underTest.EnableReload(func() error {
+		reloads++
+		return nil
 	})
 
 	serverRunWg := &sync.WaitGroup{}
 	serverRunWg.Add(1)
-	underTest.Start(serverRunWg)
+	assert.NoError(t, underTest.Start(serverRunWg))
 	time.Sleep(2 * time.Second)
 
 	t.Cleanup(func() {
@@ -55,4 +63,59 @@ func TestHttpServer(t *testing.T) {
 		// Health endpoint should respond (either healthy or unhealthy)
 		assert.Contains(t, []string{"200 OK", "503 Service Unavailable"}, resp.Status)
 	})
+
+	t.Run("serves reload endpoint for POST requests only", func(t *testing.T) {
+		resp, err := httpClient.Get(fmt.Sprintf("http://localhost:%v/-/reload", underTest.Port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "405 Method Not Allowed", resp.Status)
+
+		resp, err = httpClient.Post(fmt.Sprintf("http://localhost:%v/-/reload", underTest.Port), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "200 OK", resp.Status)
+		assert.Equal(t, 1, reloads)
+	})
+}
+
+func TestHttpServerStartErrors(t *testing.T) {
+	inUse, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer inUse.Close()
+
+	tests := []struct {
+		name   string
+		http   HTTP
+		errMsg string
+	}{
+		{
+			name:   "port already in use",
+			http:   HTTP{Port: inUse.Addr().(*net.TCPAddr).Port},
+			errMsg: "address already in use",
+		},
+		{
+			name:   "missing certificate",
+			http:   HTTP{TLS: &TLS{CertFile: "missing.crt", KeyFile: "missing.key"}},
+			errMsg: "missing.crt",
+		},
+		{
+			name:   "missing bearer token file",
+			http:   HTTP{Auth: &Auth{BearerTokenFiles: []string{"missing.token"}}},
+			errMsg: "missing.token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.http.Prometheus, tt.http.Health, tt.http.Liveliness = "/metrics", "/health", "/live"
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			err := NewHttpServer(Config{HTTP: tt.http, MongoDb: MongoDB{URI: "mongodb://localhost:27017"}}, prometheus.NewRegistry()).Start(wg)
+
+			assert.ErrorContains(t, err, tt.errMsg)
+			wg.Wait()
+		})
+	}
 }
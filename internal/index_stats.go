@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var indexStatsPipeline = mustParsePipeline(`[{"$indexStats": {}}]`)
+
+// indexStatsMetric defines the metrics exported for every index
+// The values refer to the attributes of the documents built by indexStatsResults.
+var indexStatsMetric = Metric{
+	Name: "mongodb_index",
+	TagAttributes: map[string]string{
+		"db":         "db",
+		"collection": "collection",
+		"index":      "index",
+	},
+	Values: []MetricValue{
+		{Attribute: "ops", Name: "mongodb_index_accesses_total", Type: MetricTypeCounter,
+			Help: "Number of operations which used the index since the accesses are counted"},
+		{Attribute: "since", Name: "mongodb_index_accesses_since_timestamp_seconds",
+			Help: "Unix timestamp since when the accesses of the index are counted"},
+	},
+}
+
+// NewIndexStatsCollector creates a collector exporting the accesses of all indexes of the selected collections
+// of the given target
+func NewIndexStatsCollector(c Discovery, t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) BuiltinCollector {
+	return newDiscoveredCollector("indexStats", c, indexStatsMetric, indexStatsPipeline, indexStatsResults, t, timeout, con, errorC, metrics)
+}
+
+// indexStatsResults returns one document per index
+// On sharded clusters, the accesses of all shards are summed up and counted since the latest start of all shards,
+// so that an index without accesses was unused on every shard for the whole time span.
+func indexStatsResults(ns namespace, stats []bson.M) []bson.M {
+	results := make([]bson.M, 0, len(stats))
+	byIndex := make(map[string]bson.M, len(stats))
+	for _, s := range stats {
+		index, _ := s["name"].(string)
+		ops, err := extractNumber(s, "accesses.ops", "indexStats")
+		if index == "" || err != nil {
+			continue
+		}
+		since, err := extractTime(s, "accesses.since")
+		if err != nil {
+			continue
+		}
+
+		result, exists := byIndex[index]
+		if !exists {
+			result = bson.M{"db": ns.db, "collection": ns.collection, "index": index, "ops": 0.0, "since": 0.0}
+			byIndex[index] = result
+			results = append(results, result)
+		}
+		result["ops"] = result["ops"].(float64) + ops
+		if s := unixSeconds(since); s > result["since"].(float64) {
+			result["since"] = s
+		}
+	}
+	return results
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func indexStats(name string, ops int64, since time.Time) bson.M {
+	return bson.M{"name": name, "accesses": bson.M{"ops": ops, "since": primitive.NewDateTimeFromTime(since)}}
+}
+
+func TestIndexStatsCollector(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+
+	t.Run("exports the accesses of all indexes", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		onAggregate(con, "shop", "orders", indexStatsPipeline, indexStats("_id_", 42, since), indexStats("status_1", 0, since))
+		config := Discovery{Collections: []string{"shop.orders"}}
+
+		c := NewIndexStatsCollector(config, Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_index_accesses_total Number of operations which used the index since the accesses are counted
+# TYPE mongodb_index_accesses_total counter
+mongodb_index_accesses_total{collection="orders",db="shop",index="_id_"} 42
+mongodb_index_accesses_total{collection="orders",db="shop",index="status_1"} 0
+# HELP mongodb_index_accesses_since_timestamp_seconds Unix timestamp since when the accesses of the index are counted
+# TYPE mongodb_index_accesses_since_timestamp_seconds gauge
+mongodb_index_accesses_since_timestamp_seconds{collection="orders",db="shop",index="_id_"} 1.7e+09
+mongodb_index_accesses_since_timestamp_seconds{collection="orders",db="shop",index="status_1"} 1.7e+09
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("sums up the accesses of all shards", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		onAggregate(con, "shop", "orders", indexStatsPipeline,
+			indexStats("_id_", 40, since), indexStats("_id_", 2, since.Add(time.Hour)))
+		config := Discovery{Collections: []string{"shop.orders"}}
+
+		c := NewIndexStatsCollector(config, Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_index_accesses_total Number of operations which used the index since the accesses are counted
+# TYPE mongodb_index_accesses_total counter
+mongodb_index_accesses_total{collection="orders",db="shop",index="_id_"} 42
+# HELP mongodb_index_accesses_since_timestamp_seconds Unix timestamp since when the accesses of the index are counted
+# TYPE mongodb_index_accesses_since_timestamp_seconds gauge
+mongodb_index_accesses_since_timestamp_seconds{collection="orders",db="shop",index="_id_"} 1.7000036e+09
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+}
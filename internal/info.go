@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// invalidLabelChars matches all characters which are not allowed in prometheus label names
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// buildInfos exports every result document of an info metric without tagAttributes with all its fields as labels
+// The fields are selected by the query, e.g. with a projection. Nested documents are flattened to labels like
+// address_country, arrays and other values which cannot be formatted as label values are skipped.
+// The label names are derived per document, all of them share the described name and constant tags of the metric.
+func (col *Collector) buildInfos(results []bson.M) ([]prometheus.Metric, string, error) {
+	metrics := make([]prometheus.Metric, 0, len(results))
+	for _, result := range results {
+		fields := make(map[string]string)
+		flattenInfoFields(fields, "", map[string]interface{}(result))
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			if _, isTag := col.config.Tags[name]; !isTag {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, name := range names {
+			values[i] = fields[name]
+		}
+
+		desc := prometheus.NewDesc(col.config.Name, col.config.Help, names, col.config.Tags)
+		metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+		if err != nil {
+			return nil, "extract_tags_failed", fmt.Errorf("info labels %v: %w", names, err)
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, "", nil
+}
+
+// flattenInfoFields adds all scalar fields of the document to the labels, prefixing nested fields with their parent
+// Fields whose sanitized name is already taken are skipped, so that the result does not depend on map ordering.
+func flattenInfoFields(labels map[string]string, prefix string, doc map[string]interface{}) {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := labelName(prefix + key)
+		switch v := doc[key].(type) {
+		case bson.M:
+			flattenInfoFields(labels, name+"_", map[string]interface{}(v))
+		case primitive.M:
+			flattenInfoFields(labels, name+"_", map[string]interface{}(v))
+		case map[string]interface{}:
+			flattenInfoFields(labels, name+"_", v)
+		case primitive.D:
+			nested := make(map[string]interface{}, len(v))
+			for _, e := range v {
+				nested[e.Key] = e.Value
+			}
+			flattenInfoFields(labels, name+"_", nested)
+		default:
+			value, ok := formatInfoValue(v)
+			// Names starting with two underscores are reserved for prometheus
+			if _, taken := labels[name]; ok && !taken && name != "" && !strings.HasPrefix(name, "__") {
+				labels[name] = value
+			}
+		}
+	}
+}
+
+// formatInfoValue converts a scalar field into a label value, identifiers are exported in their hex representation
+func formatInfoValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v.Hex(), true
+	case bson.ObjectId:
+		return v.Hex(), true
+	default:
+		return formatTagValue(value)
+	}
+}
+
+// labelName replaces all characters which are invalid in label names with underscores
+func labelName(field string) string {
+	name := invalidLabelChars.ReplaceAllString(field, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestInfoMetrics(t *testing.T) {
+	infoMetric := func() Metric {
+		return Metric{
+			Name:       "fruitstore_deliverer_info",
+			Help:       "Deliverers",
+			Type:       MetricTypeInfo,
+			Db:         "fruitstore",
+			Collection: "deliverers",
+			Find:       "{}",
+			Tags:       map[string]string{"region": "eu"},
+		}
+	}
+
+	t.Run("exports all returned fields as labels", func(t *testing.T) {
+		metric := infoMetric()
+		id := primitive.NewObjectID()
+		con := findMock(metric,
+			bson.M{"_id": id, "name": "Fresh Fruits", "address": primitive.D{{Key: "country", Value: "DE"}}, "rating": int32(4)},
+			bson.M{"_id": "b", "name": "Veggies", "tags": primitive.A{"organic"}, "region": "us", "2nd-name": "V"},
+		)
+
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP fruitstore_deliverer_info Deliverers
+# TYPE fruitstore_deliverer_info gauge
+fruitstore_deliverer_info{_id="` + id.Hex() + `",address_country="DE",name="Fresh Fruits",rating="4",region="eu"} 1
+fruitstore_deliverer_info{_2nd_name="V",_id="b",name="Veggies",region="eu"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("keeps the configured tagAttributes", func(t *testing.T) {
+		metric := infoMetric()
+		metric.TagAttributes = map[string]string{"name": "name"}
+		con := findMock(metric, bson.M{"_id": "a", "name": "Fresh Fruits"})
+
+		c := NewCollector(metric, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP fruitstore_deliverer_info Deliverers
+# TYPE fruitstore_deliverer_info gauge
+fruitstore_deliverer_info{name="Fresh Fruits",region="eu"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+}
+
+func TestLabelName(t *testing.T) {
+	assert.Equal(t, "address_country", labelName("address.country"))
+	assert.Equal(t, "_1st", labelName("1st"))
+	assert.Equal(t, "_id", labelName("_id"))
+}
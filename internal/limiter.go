@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Limiter bounds the number of concurrently running mongoDB queries, globally and per database of a target
+// A limit of zero disables the respective bound
+type Limiter struct {
+	global  chan struct{}
+	perDb   int
+	dbs     map[dbKey]chan struct{}
+	metrics *Metrics
+	mu      sync.Mutex
+}
+
+// dbKey identifies a database of a target, since equally named databases of different targets are independent
+type dbKey struct {
+	target string
+	db     string
+}
+
+// NewLimiter creates a Limiter allowing maxConcurrency queries in total and maxPerDb queries per database
+func NewLimiter(maxConcurrency int, maxPerDb int, metrics *Metrics) *Limiter {
+	l := &Limiter{
+		perDb:   maxPerDb,
+		dbs:     make(map[dbKey]chan struct{}),
+		metrics: metrics,
+	}
+	if maxConcurrency > 0 {
+		l.global = make(chan struct{}, maxConcurrency)
+	}
+	return l
+}
+
+// Acquire blocks until a query on the given database of the target may run or the context is done
+// The returned function must be called to release the slot again
+func (l *Limiter) Acquire(ctx context.Context, target string, db string) (func(), error) {
+	start := time.Now()
+	defer func() {
+		l.metrics.QueueWait.WithLabelValues(target, db).Observe(time.Since(start).Seconds())
+	}()
+
+	dbSlots := l.dbSlots(dbKey{target: target, db: db})
+	if err := acquireSlot(ctx, dbSlots); err != nil {
+		return nil, err
+	}
+	if err := acquireSlot(ctx, l.global); err != nil {
+		releaseSlot(dbSlots)
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releaseSlot(l.global)
+			releaseSlot(dbSlots)
+		})
+	}, nil
+}
+
+func (l *Limiter) dbSlots(key dbKey) chan struct{} {
+	if l.perDb <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots, exists := l.dbs[key]
+	if !exists {
+		slots = make(chan struct{}, l.perDb)
+		l.dbs[key] = slots
+	}
+	return slots
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// limitedConnection enforces a Limiter around every query of the wrapped connection
+// The slot is held until the returned cursor is closed
+type limitedConnection struct {
+	con     wrapper.IConnection
+	limiter *Limiter
+	target  string
+}
+
+// NewLimitedConnection wraps the connection of the given target, so that all queries are bounded by the limiter
+func NewLimitedConnection(con wrapper.IConnection, limiter *Limiter, target string) wrapper.IConnection {
+	return &limitedConnection{
+		con:     con,
+		limiter: limiter,
+		target:  target,
+	}
+}
+
+// Aggregate executes the aggregate query as soon as the limiter grants a slot
+func (l *limitedConnection) Aggregate(ctx context.Context, db string, collection string, pipeline bson.A, opts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	release, err := l.limiter.Acquire(ctx, l.target, db)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := l.con.Aggregate(ctx, db, collection, pipeline, opts)
+	return limitCursor(cur, err, release)
+}
+
+// Find executes the find query as soon as the limiter grants a slot
+func (l *limitedConnection) Find(ctx context.Context, db string, collection string, filter bson.D, opts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	release, err := l.limiter.Acquire(ctx, l.target, db)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := l.con.Find(ctx, db, collection, filter, opts)
+	return limitCursor(cur, err, release)
+}
+
+// RunCommand executes the database command as soon as the limiter grants a slot
+// The slot is released as soon as the command returns, since its result is not streamed
+func (l *limitedConnection) RunCommand(ctx context.Context, db string, command bson.D, opts wrapper.QueryOptions) (wrapper.ISingleResult, error) {
+	release, err := l.limiter.Acquire(ctx, l.target, db)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.con.RunCommand(ctx, db, command, opts)
+}
+
+// ListCollectionNames lists the collections as soon as the limiter grants a slot
+func (l *limitedConnection) ListCollectionNames(ctx context.Context, db string, filter bson.D) ([]string, error) {
+	release, err := l.limiter.Acquire(ctx, l.target, db)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return l.con.ListCollectionNames(ctx, db, filter)
+}
+
+// Watch opens the change stream without a slot, since it stays open as long as its collector runs
+func (l *limitedConnection) Watch(ctx context.Context, db string, collection string, pipeline bson.A, resume wrapper.ResumeToken, opts wrapper.QueryOptions) (wrapper.IChangeStream, error) {
+	return l.con.Watch(ctx, db, collection, pipeline, resume, opts)
+}
+
+// Disconnect closes the wrapped connection
+func (l *limitedConnection) Disconnect(ctx context.Context) error {
+	return l.con.Disconnect(ctx)
+}
+
+func limitCursor(cur wrapper.ICursor, err error, release func()) (wrapper.ICursor, error) {
+	if err != nil || cur == nil {
+		release()
+		return cur, err
+	}
+	return &limitedCursor{ICursor: cur, release: release}, nil
+}
+
+// limitedCursor releases its limiter slot when closed
+type limitedCursor struct {
+	wrapper.ICursor
+	release func()
+}
+
+// Close closes the wrapped cursor and releases the limiter slot
+func (c *limitedCursor) Close(ctx context.Context) error {
+	defer c.release()
+	return c.ICursor.Close(ctx)
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("blocks when the global limit is reached", func(t *testing.T) {
+		limiter := NewLimiter(1, 0, testMetrics())
+
+		release, err := limiter.Acquire(context.Background(), "", "db1")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(ctx, "", "db2")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		release()
+		release2, err := limiter.Acquire(context.Background(), "", "db2")
+		assert.NoError(t, err)
+		release2()
+	})
+
+	t.Run("blocks per database only for the same database", func(t *testing.T) {
+		limiter := NewLimiter(0, 1, testMetrics())
+
+		release, err := limiter.Acquire(context.Background(), "", "db1")
+		assert.NoError(t, err)
+		defer release()
+
+		other, err := limiter.Acquire(context.Background(), "", "db2")
+		assert.NoError(t, err)
+		other()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(ctx, "", "db1")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("limits equally named databases of different targets independently", func(t *testing.T) {
+		limiter := NewLimiter(0, 1, testMetrics())
+
+		release, err := limiter.Acquire(context.Background(), "eu", "shop")
+		assert.NoError(t, err)
+		defer release()
+
+		other, err := limiter.Acquire(context.Background(), "us", "shop")
+		assert.NoError(t, err)
+		other()
+	})
+
+	t.Run("releasing twice frees only one slot", func(t *testing.T) {
+		limiter := NewLimiter(2, 0, testMetrics())
+
+		release, _ := limiter.Acquire(context.Background(), "", "db")
+		other, _ := limiter.Acquire(context.Background(), "", "db")
+		release()
+		release()
+
+		assert.Equal(t, 1, len(limiter.global))
+		other()
+	})
+}
+
+func TestLimitedConnection(t *testing.T) {
+	t.Run("holds the slot until the cursor is closed", func(t *testing.T) {
+		limiter := NewLimiter(1, 0, testMetrics())
+		cursor := &mocks.ICursor{}
+		cursor.On("Close", mock.Anything).Return(nil).Once()
+		con := &mocks.IConnection{}
+		con.On("Find", mock.Anything, "db", "col", mustParseDocument("{}"), mock.Anything).Return(cursor, nil).Once()
+
+		limited := NewLimitedConnection(con, limiter, "")
+		cur, err := limited.Find(context.Background(), "db", "col", mustParseDocument("{}"), wrapper.QueryOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(limiter.global))
+
+		assert.NoError(t, cur.Close(context.Background()))
+		assert.Equal(t, 0, len(limiter.global))
+		con.AssertExpectations(t)
+	})
+
+	t.Run("releases the slot if the query fails", func(t *testing.T) {
+		limiter := NewLimiter(1, 0, testMetrics())
+		con := &mocks.IConnection{}
+		con.On("Aggregate", mock.Anything, "db", "col", mustParsePipeline("[]"), mock.Anything).Return(nil, assert.AnError).Once()
+
+		limited := NewLimitedConnection(con, limiter, "")
+		_, err := limited.Aggregate(context.Background(), "db", "col", mustParsePipeline("[]"), wrapper.QueryOptions{})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, 0, len(limiter.global))
+	})
+
+	t.Run("releases the slot after a command", func(t *testing.T) {
+		limiter := NewLimiter(1, 0, testMetrics())
+		res := &mocks.ISingleResult{}
+		con := &mocks.IConnection{}
+		con.On("RunCommand", mock.Anything, "admin", mustParseDocument(`{"ping": 1}`), mock.Anything).Return(res, nil).Once()
+
+		limited := NewLimitedConnection(con, limiter, "")
+		actual, err := limited.RunCommand(context.Background(), "admin", mustParseDocument(`{"ping": 1}`), wrapper.QueryOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, res, actual)
+		assert.Equal(t, 0, len(limiter.global))
+	})
+}
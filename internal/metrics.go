@@ -5,50 +5,111 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
+// Metrics are the internal metrics of the exporter about its own operation
+type Metrics struct {
 	// QueryDuration tracks how long MongoDB queries take
-	QueryDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "mongodb_exporter_query_duration_seconds",
-			Help: "Duration of MongoDB queries in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"metric_name", "db", "collection", "query_type"},
-	)
-
+	QueryDuration *prometheus.HistogramVec
+	// QueueWait tracks how long MongoDB queries wait for a free concurrency slot
+	QueueWait *prometheus.HistogramVec
 	// QueryErrors tracks MongoDB query errors
-	QueryErrors = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "mongodb_exporter_query_errors_total",
-			Help: "Total number of MongoDB query errors",
-		},
-		[]string{"metric_name", "db", "collection", "error_type"},
-	)
-
+	QueryErrors *prometheus.CounterVec
 	// ActiveQueries tracks currently running queries
-	ActiveQueries = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "mongodb_exporter_active_queries",
-			Help: "Number of currently active MongoDB queries",
-		},
-		[]string{"db", "collection"},
-	)
-
+	ActiveQueries *prometheus.GaugeVec
 	// ConnectionStatus tracks MongoDB connection status
-	ConnectionStatus = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "mongodb_exporter_connection_status",
-			Help: "MongoDB connection status (1=connected, 0=disconnected)",
-		},
-		[]string{"uri"},
-	)
-
+	ConnectionStatus *prometheus.GaugeVec
 	// MetricsCollected tracks successful metric collections
-	MetricsCollected = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "mongodb_exporter_metrics_collected_total",
-			Help: "Total number of metrics successfully collected",
-		},
-		[]string{"metric_name"},
-	)
-)
+	MetricsCollected *prometheus.CounterVec
+	// LastSuccess tracks the time of the last successful query per metric
+	LastSuccess *prometheus.GaugeVec
+	// ConfigLastReloadSuccessful tracks whether the last config reload succeeded
+	ConfigLastReloadSuccessful prometheus.Gauge
+	// ConfigLastReloadSuccessTimestamp tracks the time of the last successful config reload
+	ConfigLastReloadSuccessTimestamp prometheus.Gauge
+	// ConfigHash exposes a hash of the currently applied config
+	ConfigHash prometheus.Gauge
+}
+
+// NewMetrics creates the internal metrics and registers them with the given registerer
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	factory := promauto.With(registerer)
+	return &Metrics{
+		QueryDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "mongodb_exporter_query_duration_seconds",
+				Help:    "Duration of MongoDB queries in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"target", "metric_name", "db", "collection", "query_type"},
+		),
+
+		QueueWait: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "mongodb_exporter_query_queue_wait_seconds",
+				Help:    "Time MongoDB queries wait for a free concurrency slot in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"target", "db"},
+		),
+
+		QueryErrors: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mongodb_exporter_query_errors_total",
+				Help: "Total number of MongoDB query errors",
+			},
+			[]string{"target", "metric_name", "db", "collection", "error_type"},
+		),
+
+		ActiveQueries: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_active_queries",
+				Help: "Number of currently active MongoDB queries",
+			},
+			[]string{"target", "db", "collection"},
+		),
+
+		ConnectionStatus: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_connection_status",
+				Help: "MongoDB connection status (1=connected, 0=disconnected)",
+			},
+			[]string{"target"},
+		),
+
+		MetricsCollected: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mongodb_exporter_metrics_collected_total",
+				Help: "Total number of metrics successfully collected",
+			},
+			[]string{"target", "metric_name"},
+		),
+
+		LastSuccess: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_last_success_timestamp_seconds",
+				Help: "Unix timestamp of the last successful MongoDB query per metric",
+			},
+			[]string{"target", "metric_name"},
+		),
+
+		ConfigLastReloadSuccessful: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_config_last_reload_successful",
+				Help: "Whether the last configuration reload attempt was successful (1=success, 0=failure)",
+			},
+		),
+
+		ConfigLastReloadSuccessTimestamp: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_config_last_reload_success_timestamp_seconds",
+				Help: "Unix timestamp of the last successful configuration reload",
+			},
+		),
+
+		ConfigHash: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mongodb_exporter_config_hash",
+				Help: "Hash of the currently applied configuration",
+			},
+		),
+	}
+}
@@ -5,6 +5,8 @@ package mocks
 import (
 	context "context"
 
+	bson "go.mongodb.org/mongo-driver/bson"
+
 	wrapper "github.com/ppussar/mongodb_exporter/internal/wrapper"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -14,13 +16,13 @@ type IConnection struct {
 	mock.Mock
 }
 
-// Aggregate provides a mock function with given fields: ctx, db, collection, command
-func (_m *IConnection) Aggregate(ctx context.Context, db string, collection string, command string) (wrapper.ICursor, error) {
-	ret := _m.Called(ctx, db, collection, command)
+// Aggregate provides a mock function with given fields: ctx, db, collection, pipeline, opts
+func (_m *IConnection) Aggregate(ctx context.Context, db string, collection string, pipeline bson.A, opts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	ret := _m.Called(ctx, db, collection, pipeline, opts)
 
 	var r0 wrapper.ICursor
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) wrapper.ICursor); ok {
-		r0 = rf(ctx, db, collection, command)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bson.A, wrapper.QueryOptions) wrapper.ICursor); ok {
+		r0 = rf(ctx, db, collection, pipeline, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(wrapper.ICursor)
@@ -28,8 +30,8 @@ func (_m *IConnection) Aggregate(ctx context.Context, db string, collection stri
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
-		r1 = rf(ctx, db, collection, command)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bson.A, wrapper.QueryOptions) error); ok {
+		r1 = rf(ctx, db, collection, pipeline, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -37,13 +39,27 @@ func (_m *IConnection) Aggregate(ctx context.Context, db string, collection stri
 	return r0, r1
 }
 
-// Find provides a mock function with given fields: ctx, db, collection, command
-func (_m *IConnection) Find(ctx context.Context, db string, collection string, command string) (wrapper.ICursor, error) {
-	ret := _m.Called(ctx, db, collection, command)
+// Disconnect provides a mock function with given fields: ctx
+func (_m *IConnection) Disconnect(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Find provides a mock function with given fields: ctx, db, collection, filter, opts
+func (_m *IConnection) Find(ctx context.Context, db string, collection string, filter bson.D, opts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	ret := _m.Called(ctx, db, collection, filter, opts)
 
 	var r0 wrapper.ICursor
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) wrapper.ICursor); ok {
-		r0 = rf(ctx, db, collection, command)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bson.D, wrapper.QueryOptions) wrapper.ICursor); ok {
+		r0 = rf(ctx, db, collection, filter, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(wrapper.ICursor)
@@ -51,8 +67,77 @@ func (_m *IConnection) Find(ctx context.Context, db string, collection string, c
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
-		r1 = rf(ctx, db, collection, command)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bson.D, wrapper.QueryOptions) error); ok {
+		r1 = rf(ctx, db, collection, filter, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCollectionNames provides a mock function with given fields: ctx, db, filter
+func (_m *IConnection) ListCollectionNames(ctx context.Context, db string, filter bson.D) ([]string, error) {
+	ret := _m.Called(ctx, db, filter)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, bson.D) []string); ok {
+		r0 = rf(ctx, db, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, bson.D) error); ok {
+		r1 = rf(ctx, db, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RunCommand provides a mock function with given fields: ctx, db, command, opts
+func (_m *IConnection) RunCommand(ctx context.Context, db string, command bson.D, opts wrapper.QueryOptions) (wrapper.ISingleResult, error) {
+	ret := _m.Called(ctx, db, command, opts)
+
+	var r0 wrapper.ISingleResult
+	if rf, ok := ret.Get(0).(func(context.Context, string, bson.D, wrapper.QueryOptions) wrapper.ISingleResult); ok {
+		r0 = rf(ctx, db, command, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(wrapper.ISingleResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, bson.D, wrapper.QueryOptions) error); ok {
+		r1 = rf(ctx, db, command, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Watch provides a mock function with given fields: ctx, db, collection, pipeline, resume, opts
+func (_m *IConnection) Watch(ctx context.Context, db string, collection string, pipeline bson.A, resume wrapper.ResumeToken, opts wrapper.QueryOptions) (wrapper.IChangeStream, error) {
+	ret := _m.Called(ctx, db, collection, pipeline, resume, opts)
+
+	var r0 wrapper.IChangeStream
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bson.A, wrapper.ResumeToken, wrapper.QueryOptions) wrapper.IChangeStream); ok {
+		r0 = rf(ctx, db, collection, pipeline, resume, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(wrapper.IChangeStream)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bson.A, wrapper.ResumeToken, wrapper.QueryOptions) error); ok {
+		r1 = rf(ctx, db, collection, pipeline, resume, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
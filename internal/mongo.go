@@ -2,13 +2,14 @@ package internal
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/ppussar/mongodb_exporter/internal/wrapper"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 // Connection to mongoDB
@@ -33,25 +34,152 @@ func NewConnection(uri string) (wrapper.IConnection, error) {
 	return client, err
 }
 
+// maxTimeMSExpiredCode is the server error code of operations exceeding their maxTimeMS
+const maxTimeMSExpiredCode = 50
+
+// Server error codes of change streams, which cannot be resumed with their resume token
+const (
+	changeStreamHistoryLostCode = 286
+	changeStreamFatalErrorCode  = 280
+	invalidResumeTokenCode      = 260
+)
+
 // Aggregate executes a given aggregate query on the mongodb
-func (con Connection) Aggregate(ctx context.Context, db string, collection string, command string) (wrapper.ICursor, error) {
-	var pipeline interface{}
-	err := bson.UnmarshalExtJSON([]byte(command), true, &pipeline)
-	if err != nil {
-		fmt.Println(command)
-		return nil, err
+// Without collection, the pipeline runs on the database, e.g. for $currentOp on admin
+func (con Connection) Aggregate(ctx context.Context, db string, collection string, pipeline bson.A, queryOpts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	opts := options.Aggregate()
+	if queryOpts.MaxTime > 0 {
+		opts.SetMaxTime(queryOpts.MaxTime)
+	}
+	if queryOpts.Hint != nil {
+		opts.SetHint(queryOpts.Hint)
 	}
-	opts := options.Aggregate().SetMaxTime(2 * time.Second)
-	return con.client.Database(db).Collection(collection).Aggregate(ctx, pipeline, opts)
+	if queryOpts.Collation != nil {
+		opts.SetCollation(queryOpts.Collation)
+	}
+	if queryOpts.BatchSize > 0 {
+		opts.SetBatchSize(queryOpts.BatchSize)
+	}
+	if collection == "" {
+		return con.database(db, queryOpts).Aggregate(ctx, pipeline, opts)
+	}
+	return con.database(db, queryOpts).Collection(collection).Aggregate(ctx, pipeline, opts)
 }
 
 // Find executes a given find query on the mongodb
-func (con Connection) Find(ctx context.Context, db string, collection string, command string) (wrapper.ICursor, error) {
-	var bdoc interface{}
-	err := bson.UnmarshalExtJSON([]byte(command), true, &bdoc)
+func (con Connection) Find(ctx context.Context, db string, collection string, filter bson.D, queryOpts wrapper.QueryOptions) (wrapper.ICursor, error) {
+	opts := options.Find()
+	if queryOpts.MaxTime > 0 {
+		opts.SetMaxTime(queryOpts.MaxTime)
+	}
+	if queryOpts.Projection != nil {
+		opts.SetProjection(queryOpts.Projection)
+	}
+	if queryOpts.Sort != nil {
+		opts.SetSort(queryOpts.Sort)
+	}
+	if queryOpts.Limit > 0 {
+		opts.SetLimit(queryOpts.Limit)
+	}
+	if queryOpts.Skip > 0 {
+		opts.SetSkip(queryOpts.Skip)
+	}
+	if queryOpts.Hint != nil {
+		opts.SetHint(queryOpts.Hint)
+	}
+	if queryOpts.Collation != nil {
+		opts.SetCollation(queryOpts.Collation)
+	}
+	if queryOpts.BatchSize > 0 {
+		opts.SetBatchSize(queryOpts.BatchSize)
+	}
+	return con.database(db, queryOpts).Collection(collection).Find(ctx, filter, opts)
+}
+
+// RunCommand executes a given database command on the mongodb
+// The first key of the command document names the command
+func (con Connection) RunCommand(ctx context.Context, db string, command bson.D, queryOpts wrapper.QueryOptions) (wrapper.ISingleResult, error) {
+	cmd := command
+	if queryOpts.MaxTime > 0 {
+		// The parsed command is shared by all collections and must not be modified
+		cmd = make(bson.D, 0, len(command)+1)
+		cmd = append(cmd, command...)
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: queryOpts.MaxTime.Milliseconds()})
+	}
+	opts := options.RunCmd()
+	if queryOpts.ReadPreference != nil {
+		// Commands run on the primary unless a read preference is given explicitly
+		opts.SetReadPreference(queryOpts.ReadPreference)
+	}
+	return con.database(db, queryOpts).RunCommand(ctx, cmd, opts), nil
+}
+
+// ListCollectionNames lists the collections of the database matching the filter
+// The driver iterates the whole cursor, since the first batch is limited to 101 collections
+func (con Connection) ListCollectionNames(ctx context.Context, db string, filter bson.D) ([]string, error) {
+	return con.client.Database(db).ListCollectionNames(ctx, filter)
+}
+
+// Watch opens a change stream on the collection, or on the whole database if no collection is given
+// The stream resumes after the given resume token, if any.
+func (con Connection) Watch(ctx context.Context, db string, collection string, pipeline bson.A, resume wrapper.ResumeToken, queryOpts wrapper.QueryOptions) (wrapper.IChangeStream, error) {
+	opts := options.ChangeStream()
+	if resume.Token != nil && resume.StartAfter {
+		opts.SetStartAfter(resume.Token)
+	} else if resume.Token != nil {
+		opts.SetResumeAfter(resume.Token)
+	}
+
+	var stream *mongo.ChangeStream
+	var err error
+	if collection == "" {
+		stream, err = con.database(db, queryOpts).Watch(ctx, pipeline, opts)
+	} else {
+		stream, err = con.database(db, queryOpts).Collection(collection).Watch(ctx, pipeline, opts)
+	}
 	if err != nil {
-		fmt.Println(command)
 		return nil, err
 	}
-	return con.client.Database(db).Collection(collection).Find(ctx, &bdoc)
+	return stream, nil
+}
+
+// Disconnect closes all sockets of the connection
+func (con Connection) Disconnect(ctx context.Context) error {
+	return con.client.Disconnect(ctx)
+}
+
+// database returns the handle of the database, which applies the read preference and read concern of the query
+// to all of its collections
+func (con Connection) database(db string, queryOpts wrapper.QueryOptions) *mongo.Database {
+	opts := options.Database()
+	if queryOpts.ReadPreference != nil {
+		opts.SetReadPreference(queryOpts.ReadPreference)
+	}
+	if queryOpts.ReadConcern != nil {
+		opts.SetReadConcern(queryOpts.ReadConcern)
+	}
+	return con.client.Database(db, opts)
+}
+
+// isMaxTimeExpired reports whether the server aborted an operation because it exceeded its maxTimeMS
+func isMaxTimeExpired(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(maxTimeMSExpiredCode)
+}
+
+// isResumeTokenLost reports whether a change stream cannot be resumed, e.g. because the oplog no longer contains its resume token
+func isResumeTokenLost(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(changeStreamHistoryLostCode) || serverErr.HasErrorCode(changeStreamFatalErrorCode) || serverErr.HasErrorCode(invalidResumeTokenCode))
+}
+
+// errNoConnection fails queries of collectors which have not received a connection yet
+var errNoConnection = errors.New("no MongoDB connection available")
+
+// isConnectionError reports whether an operation failed because the deployment is unreachable, which requires a reconnect
+// Errors returned by the server, e.g. for unsupported commands or missing privileges, are no connection errors.
+func isConnectionError(err error) bool {
+	return errors.Is(err, errNoConnection) || mongo.IsNetworkError(err) || errors.Is(err, mongo.ErrClientDisconnected) ||
+		errors.As(err, &topology.ServerSelectionError{})
 }
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PathErrorKind classifies why an attribute path could not be resolved
+type PathErrorKind string
+
+const (
+	// PathNotFound is reported when a path segment does not exist in the result
+	PathNotFound PathErrorKind = "path_not_found"
+	// PathNotTraversable is reported when a path segment points into a value which is neither a document nor an array
+	PathNotTraversable PathErrorKind = "path_not_traversable"
+)
+
+// PathError is returned when a dotted attribute path cannot be resolved in a query result
+type PathError struct {
+	Kind    PathErrorKind
+	Path    string
+	Segment string
+	Reason  string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("path '%s': segment '%s' %s", e.Path, e.Segment, e.Reason)
+}
+
+// lookupPath resolves an attribute path like "stats.count" or "items.0.sku" in a decoded result document.
+// A key containing dots that exists verbatim on the top level takes precedence over the nested lookup.
+func lookupPath(doc bson.M, path string) (interface{}, error) {
+	if val, exists := doc[path]; exists {
+		return val, nil
+	}
+
+	var current interface{} = doc
+	for _, segment := range strings.Split(path, ".") {
+		next, err := lookupSegment(current, segment)
+		if err != nil {
+			err.Path = path
+			return nil, err
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func lookupSegment(current interface{}, segment string) (interface{}, *PathError) {
+	switch v := current.(type) {
+	case bson.M:
+		return lookupKey(map[string]interface{}(v), segment)
+	case primitive.M:
+		return lookupKey(map[string]interface{}(v), segment)
+	case map[string]interface{}:
+		return lookupKey(v, segment)
+	case primitive.D:
+		for _, e := range v {
+			if e.Key == segment {
+				return e.Value, nil
+			}
+		}
+		return nil, &PathError{Kind: PathNotFound, Segment: segment, Reason: "not found"}
+	case primitive.A:
+		return lookupIndex([]interface{}(v), segment)
+	case []interface{}:
+		return lookupIndex(v, segment)
+	default:
+		return nil, &PathError{Kind: PathNotTraversable, Segment: segment, Reason: fmt.Sprintf("cannot traverse value of type %T", current)}
+	}
+}
+
+func lookupKey(m map[string]interface{}, segment string) (interface{}, *PathError) {
+	val, exists := m[segment]
+	if !exists {
+		return nil, &PathError{Kind: PathNotFound, Segment: segment, Reason: "not found"}
+	}
+	return val, nil
+}
+
+func lookupIndex(a []interface{}, segment string) (interface{}, *PathError) {
+	idx, err := strconv.Atoi(segment)
+	if err != nil {
+		return nil, &PathError{Kind: PathNotFound, Segment: segment, Reason: "is not a valid array index"}
+	}
+	if idx < 0 || idx >= len(a) {
+		return nil, &PathError{Kind: PathNotFound, Segment: segment, Reason: fmt.Sprintf("is out of range for array of length %d", len(a))}
+	}
+	return a[idx], nil
+}
+
+// lookupDocuments resolves an attribute path pointing to an array of documents, like the members of replSetGetStatus
+func lookupDocuments(doc bson.M, path string) ([]bson.M, error) {
+	val, err := lookupPath(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch v := val.(type) {
+	case primitive.A:
+		items = v
+	case []interface{}:
+		items = v
+	default:
+		return nil, fmt.Errorf("path '%s': unsupported array type %T", path, val)
+	}
+
+	docs := make([]bson.M, 0, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case bson.M:
+			docs = append(docs, v)
+		case primitive.M:
+			docs = append(docs, bson.M(v))
+		case map[string]interface{}:
+			docs = append(docs, bson.M(v))
+		case primitive.D:
+			d := bson.M{}
+			for _, e := range v {
+				d[e.Key] = e.Value
+			}
+			docs = append(docs, d)
+		default:
+			return nil, fmt.Errorf("path '%s.%d': unsupported document type %T", path, i, item)
+		}
+	}
+	return docs, nil
+}
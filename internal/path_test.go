@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestLookupPath(t *testing.T) {
+	doc := bson.M{
+		"count":       int32(3),
+		"dotted.key":  "verbatim",
+		"_id":         bson.M{"region": "eu", "status": "open"},
+		"stats":       primitive.D{{Key: "count", Value: int64(7)}},
+		"items":       primitive.A{bson.M{"sku": "A-1"}, bson.M{"sku": "B-2"}},
+		"scalarField": "abc",
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected interface{}
+		kind     PathErrorKind
+	}{
+		{name: "top level key", path: "count", expected: int32(3)},
+		{name: "top level key containing dots", path: "dotted.key", expected: "verbatim"},
+		{name: "nested document", path: "_id.region", expected: "eu"},
+		{name: "nested ordered document", path: "stats.count", expected: int64(7)},
+		{name: "array index", path: "items.1.sku", expected: "B-2"},
+		{name: "missing top level key", path: "unknown", kind: PathNotFound},
+		{name: "missing nested key", path: "_id.country", kind: PathNotFound},
+		{name: "array index out of range", path: "items.5.sku", kind: PathNotFound},
+		{name: "non numeric array index", path: "items.first", kind: PathNotFound},
+		{name: "traverse scalar", path: "scalarField.length", kind: PathNotTraversable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val, err := lookupPath(doc, tt.path)
+			if tt.kind != "" {
+				var pathErr *PathError
+				assert.True(t, errors.As(err, &pathErr))
+				assert.Equal(t, tt.kind, pathErr.Kind)
+				assert.Equal(t, tt.path, pathErr.Path)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, val)
+			}
+		})
+	}
+}
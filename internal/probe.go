@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"fmt"
+	netHttp "net/http"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ConnectionProvider returns the current connection of the target with the given name
+type ConnectionProvider func(target string) (wrapper.IConnection, error)
+
+// NewProbeHandler creates a handler which collects the metrics of a module from a single target per request,
+// in the style of the blackbox_exporter: /probe?target=<target name>&module=<module name>
+// Only targets listed in the current config can be probed. Failing queries are counted in the given internal metrics.
+func NewProbeHandler(configs func() Config, connections ConnectionProvider, internalMetrics *Metrics) netHttp.Handler {
+	return netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		config := configs()
+		targetName := r.URL.Query().Get("target")
+		module := r.URL.Query().Get("module")
+
+		target, exists := config.Target(targetName)
+		if !exists {
+			netHttp.Error(w, fmt.Sprintf("Unknown target %q", targetName), netHttp.StatusBadRequest)
+			return
+		}
+		metrics := config.ModuleMetrics(module, target)
+		if module == "" || len(metrics) == 0 {
+			netHttp.Error(w, fmt.Sprintf("Unknown module %q for target %q", module, targetName), netHttp.StatusBadRequest)
+			return
+		}
+		con, err := connections(targetName)
+		if err != nil {
+			netHttp.Error(w, fmt.Sprintf("Target %q is not available: %v", targetName, err), netHttp.StatusServiceUnavailable)
+			return
+		}
+
+		start := time.Now()
+		moduleRegistry := prometheus.NewRegistry()
+		errorC := make(chan error, len(metrics))
+		collectors := make([]*Collector, 0, len(metrics))
+		for _, m := range metrics {
+			// Probes always query synchronously
+			m.Interval = 0
+			collector := NewCollector(m, con, errorC, internalMetrics)
+			if err := moduleRegistry.Register(collector); err != nil {
+				netHttp.Error(w, fmt.Sprintf("Failed to register metric %s: %v", m.Name, err), netHttp.StatusInternalServerError)
+				return
+			}
+			collectors = append(collectors, collector)
+		}
+		families, err := moduleRegistry.Gather()
+		failed := err != nil
+		for _, collector := range collectors {
+			failed = failed || collector.failures.Load() > 0
+		}
+
+		probeRegistry := prometheus.NewRegistry()
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mongodb_exporter_probe_success",
+			Help: "Whether all queries of the probed module succeeded",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mongodb_exporter_probe_duration_seconds",
+			Help: "Duration of the probe in seconds",
+		})
+		probeRegistry.MustRegister(probeSuccess, probeDuration)
+		if !failed {
+			probeSuccess.Set(1)
+		}
+		probeDuration.Set(time.Since(start).Seconds())
+
+		gatherers := prometheus.Gatherers{
+			probeRegistry,
+			prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, err }),
+		}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
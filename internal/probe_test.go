@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	netHttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestProbeHandler(t *testing.T) {
+	metric := Metric{
+		Name:             "probe_metric",
+		Db:               "myDB",
+		Collection:       "myCollection",
+		Find:             "{}",
+		MetricsAttribute: "count",
+		Module:           "orders",
+	}
+	config := Config{
+		HTTP:    HTTP{Probe: "/probe"},
+		Targets: []Target{{Name: "cluster-a", URI: "mongodb://a:27017"}},
+		Metrics: []Metric{metric},
+	}
+
+	probe := func(query string, connections ConnectionProvider) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/probe?"+query, nil)
+		NewProbeHandler(func() Config { return config }, connections, testMetrics()).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("collects the module from the target", func(t *testing.T) {
+		con := findMock(metric, bson.M{"count": int32(5)})
+		rr := probe("target=cluster-a&module=orders", func(target string) (wrapper.IConnection, error) {
+			assert.Equal(t, "cluster-a", target)
+			return con, nil
+		})
+
+		assert.Equal(t, netHttp.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `probe_metric{target="cluster-a"} 5`)
+		assert.Contains(t, rr.Body.String(), "mongodb_exporter_probe_success 1")
+		con.AssertExpectations(t)
+	})
+
+	t.Run("reports failed queries", func(t *testing.T) {
+		con := findMock(metric, bson.M{"other": int32(5)})
+		rr := probe("target=cluster-a&module=orders", func(string) (wrapper.IConnection, error) {
+			return con, nil
+		})
+
+		assert.Equal(t, netHttp.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "mongodb_exporter_probe_success 0")
+	})
+
+	t.Run("rejects unknown targets", func(t *testing.T) {
+		rr := probe("target=mongodb://evil:27017&module=orders", nil)
+		assert.Equal(t, netHttp.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("rejects unknown modules", func(t *testing.T) {
+		rr := probe("target=cluster-a&module=unknown", nil)
+		assert.Equal(t, netHttp.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("reports unavailable targets", func(t *testing.T) {
+		rr := probe("target=cluster-a&module=orders", func(string) (wrapper.IConnection, error) {
+			return nil, fmt.Errorf("not connected")
+		})
+		assert.Equal(t, netHttp.StatusServiceUnavailable, rr.Code)
+	})
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// parsedQuery holds the parsed document of a find or command, or the parsed pipeline of an aggregate or change stream
+type parsedQuery struct {
+	document bson.D
+	pipeline bson.A
+}
+
+// parseQuery parses the rendered query of the metric
+func parseQuery(m Metric, query string) (parsedQuery, error) {
+	if strings.TrimSpace(m.Aggregate) != "" || strings.TrimSpace(m.ChangeStream) != "" {
+		pipeline, err := parsePipeline(query)
+		return parsedQuery{pipeline: pipeline}, err
+	}
+	document, err := parseDocument(query)
+	return parsedQuery{document: document}, err
+}
+
+// parseDocument parses an Extended JSON object, e.g. a find filter or a database command
+func parseDocument(query string) (bson.D, error) {
+	if err := checkJSON(query, '{', "object"); err != nil {
+		return nil, err
+	}
+	document := bson.D{}
+	if err := bson.UnmarshalExtJSON([]byte(query), true, &document); err != nil {
+		return nil, fmt.Errorf("invalid Extended JSON: %w", err)
+	}
+	return document, nil
+}
+
+// parsePipeline parses an Extended JSON array of pipeline stages
+func parsePipeline(query string) (bson.A, error) {
+	if err := checkJSON(query, '[', "array"); err != nil {
+		return nil, err
+	}
+	pipeline := bson.A{}
+	if err := bson.UnmarshalExtJSON([]byte(query), true, &pipeline); err != nil {
+		return nil, fmt.Errorf("invalid Extended JSON: %w", err)
+	}
+	return pipeline, nil
+}
+
+// queryOptions parses the find and aggregate options of the metric
+// The server side time limit is added by the collector.
+func queryOptions(m Metric) (wrapper.QueryOptions, error) {
+	opts := wrapper.QueryOptions{Limit: m.Limit, Skip: m.Skip, BatchSize: m.BatchSize}
+	var err error
+	if strings.TrimSpace(m.Projection) != "" {
+		if opts.Projection, err = parseDocument(m.Projection); err != nil {
+			return opts, fmt.Errorf("invalid projection: %w", err)
+		}
+	}
+	if strings.TrimSpace(m.Sort) != "" {
+		if opts.Sort, err = parseDocument(m.Sort); err != nil {
+			return opts, fmt.Errorf("invalid sort: %w", err)
+		}
+	}
+	if hint := strings.TrimSpace(m.Hint); strings.HasPrefix(hint, "{") {
+		if opts.Hint, err = parseDocument(hint); err != nil {
+			return opts, fmt.Errorf("invalid hint: %w", err)
+		}
+	} else if hint != "" {
+		opts.Hint = hint
+	}
+	if strings.TrimSpace(m.Collation) != "" {
+		if opts.Collation, err = parseCollation(m.Collation); err != nil {
+			return opts, fmt.Errorf("invalid collation: %w", err)
+		}
+	}
+	if m.ReadPreference != nil {
+		if opts.ReadPreference, err = newReadPref(*m.ReadPreference); err != nil {
+			return opts, fmt.Errorf("invalid readPreference: %w", err)
+		}
+	}
+	if m.ReadConcern != "" {
+		if opts.ReadConcern, err = newReadConcern(m.ReadConcern); err != nil {
+			return opts, fmt.Errorf("invalid readConcern: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// minMaxStaleness is the smallest maxStalenessSeconds accepted by the server
+const minMaxStaleness = 90 * time.Second
+
+// newReadPref creates the read preference of the driver, e.g. to route queries to tagged secondaries
+func newReadPref(rp ReadPreference) (*readpref.ReadPref, error) {
+	if rp.Mode == "" {
+		return nil, fmt.Errorf("mode cannot be empty")
+	}
+	mode, err := readpref.ModeFromString(rp.Mode)
+	if err != nil {
+		return nil, err
+	}
+	var opts []readpref.Option
+	if len(rp.TagSets) > 0 {
+		opts = append(opts, readpref.WithTagSets(tag.NewTagSetsFromMaps(rp.TagSets)...))
+	}
+	if rp.MaxStalenessSeconds != 0 {
+		maxStaleness := time.Duration(rp.MaxStalenessSeconds) * time.Second
+		if maxStaleness < minMaxStaleness {
+			return nil, fmt.Errorf("maxStalenessSeconds must be at least %d", int(minMaxStaleness.Seconds()))
+		}
+		opts = append(opts, readpref.WithMaxStaleness(maxStaleness))
+	}
+	if mode == readpref.PrimaryMode && len(opts) > 0 {
+		return nil, fmt.Errorf("tagSets and maxStalenessSeconds are not supported for mode primary")
+	}
+	return readpref.New(mode, opts...)
+}
+
+// readConcernLevels are the supported levels of read concerns
+var readConcernLevels = map[string]bool{"local": true, "available": true, "majority": true, "linearizable": true, "snapshot": true}
+
+// newReadConcern creates the read concern of the driver with the given level
+func newReadConcern(level string) (*readconcern.ReadConcern, error) {
+	if !readConcernLevels[level] {
+		return nil, fmt.Errorf("unsupported level '%s'", level)
+	}
+	return &readconcern.ReadConcern{Level: level}, nil
+}
+
+// collation maps the keys of a collation document, which differ from the bson keys of options.Collation
+type collation struct {
+	Locale          string `bson:"locale"`
+	CaseLevel       bool   `bson:"caseLevel"`
+	CaseFirst       string `bson:"caseFirst"`
+	Strength        int    `bson:"strength"`
+	NumericOrdering bool   `bson:"numericOrdering"`
+	Alternate       string `bson:"alternate"`
+	MaxVariable     string `bson:"maxVariable"`
+	Normalization   bool   `bson:"normalization"`
+	Backwards       bool   `bson:"backwards"`
+}
+
+// parseCollation parses a collation document, e.g. {"locale": "en", "strength": 2}
+func parseCollation(query string) (*options.Collation, error) {
+	if err := checkJSON(query, '{', "object"); err != nil {
+		return nil, err
+	}
+	var c collation
+	if err := bson.UnmarshalExtJSON([]byte(query), true, &c); err != nil {
+		return nil, fmt.Errorf("invalid Extended JSON: %w", err)
+	}
+	if c.Locale == "" {
+		return nil, fmt.Errorf("locale is required")
+	}
+	o := options.Collation(c)
+	return &o, nil
+}
+
+// checkJSON reports syntax errors with their offset, which the Extended JSON parser omits
+func checkJSON(query string, start byte, kind string) error {
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(query), &raw); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return fmt.Errorf("invalid JSON at offset %d: %w", syntaxErr.Offset, err)
+		}
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if trimmed := strings.TrimSpace(string(raw)); trimmed[0] != start {
+		return fmt.Errorf("query must be a JSON %s", kind)
+	}
+	return nil
+}
+
+// mustParseDocument parses the built-in commands
+func mustParseDocument(query string) bson.D {
+	document, err := parseDocument(query)
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+// mustParsePipeline parses the built-in pipelines
+func mustParsePipeline(query string) bson.A {
+	pipeline, err := parsePipeline(query)
+	if err != nil {
+		panic(err)
+	}
+	return pipeline
+}
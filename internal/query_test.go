@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Run("parses find filters and commands as documents", func(t *testing.T) {
+		q, err := parseQuery(Metric{Find: `{"status": "open"}`}, `{"status": "open", "created": {"$date": {"$numberLong": "0"}}}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, bson.D{{Key: "status", Value: "open"}, {Key: "created", Value: primitive.DateTime(0)}}, q.document)
+		assert.Nil(t, q.pipeline)
+	})
+
+	t.Run("parses aggregates and change streams as pipelines", func(t *testing.T) {
+		for _, m := range []Metric{{Aggregate: "[]"}, {ChangeStream: "[]"}} {
+			q, err := parseQuery(m, `[{"$match": {"a": 1}}]`)
+
+			assert.NoError(t, err)
+			assert.Equal(t, bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: "a", Value: int32(1)}}}}}, q.pipeline)
+			assert.Nil(t, q.document)
+		}
+	})
+
+	t.Run("parses empty queries", func(t *testing.T) {
+		filter, err := parseDocument("{}")
+		assert.NoError(t, err)
+		assert.Equal(t, bson.D{}, filter)
+
+		pipeline, err := parsePipeline(" [] ")
+		assert.NoError(t, err)
+		assert.Equal(t, bson.A{}, pipeline)
+	})
+
+	t.Run("reports the offset of malformed JSON", func(t *testing.T) {
+		_, err := parseDocument(`{"status": "open",, }`)
+		assert.ErrorContains(t, err, "invalid JSON at offset 19")
+	})
+
+	t.Run("rejects queries of the wrong kind", func(t *testing.T) {
+		_, err := parsePipeline(`{"$match": {}}`)
+		assert.EqualError(t, err, "query must be a JSON array")
+
+		_, err = parseDocument(`[]`)
+		assert.EqualError(t, err, "query must be a JSON object")
+	})
+
+	t.Run("rejects invalid Extended JSON", func(t *testing.T) {
+		_, err := parseDocument(`{"created": {"$date": "yesterday"}}`)
+		assert.ErrorContains(t, err, "invalid Extended JSON")
+	})
+}
+
+func TestCollectorParsesQueryOnce(t *testing.T) {
+	c := NewCollector(Metric{Find: `{"status": "open"}`}, nil, nil, testMetrics())
+	assert.NoError(t, c.queryErr)
+	assert.Equal(t, bson.D{{Key: "status", Value: "open"}}, c.parsed.document)
+
+	c = NewCollector(Metric{Find: `{"created": {"$gte": {{ now }}}}`}, nil, nil, testMetrics())
+	assert.NoError(t, c.queryErr)
+	assert.Nil(t, c.parsed, "templates are parsed before each collection")
+
+	c = NewCollector(Metric{Aggregate: `{}`}, nil, nil, testMetrics())
+	assert.EqualError(t, c.queryErr, "query must be a JSON array")
+}
+
+func TestQueryOptions(t *testing.T) {
+	t.Run("parses the find options", func(t *testing.T) {
+		m := Metric{
+			Find:       "{}",
+			Projection: `{"status": 1, "_id": 0}`,
+			Sort:       `{"created": -1}`,
+			Limit:      10,
+			Skip:       5,
+			Hint:       "status_1",
+			Collation:  `{"locale": "de", "strength": 2, "caseLevel": true}`,
+			BatchSize:  100,
+		}
+
+		opts, err := queryOptions(m)
+
+		assert.NoError(t, err)
+		assert.Equal(t, wrapper.QueryOptions{
+			Projection: bson.D{{Key: "status", Value: int32(1)}, {Key: "_id", Value: int32(0)}},
+			Sort:       bson.D{{Key: "created", Value: int32(-1)}},
+			Limit:      10,
+			Skip:       5,
+			Hint:       "status_1",
+			Collation:  &options.Collation{Locale: "de", Strength: 2, CaseLevel: true},
+			BatchSize:  100,
+		}, opts)
+	})
+
+	t.Run("parses index keys as hint", func(t *testing.T) {
+		opts, err := queryOptions(Metric{Hint: `{"status": 1}`})
+
+		assert.NoError(t, err)
+		assert.Equal(t, bson.D{{Key: "status", Value: int32(1)}}, opts.Hint)
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := queryOptions(Metric{Sort: `{"created": }`})
+		assert.ErrorContains(t, err, "invalid sort: invalid JSON at offset 13")
+
+		_, err = queryOptions(Metric{Collation: `{"strength": 2}`})
+		assert.EqualError(t, err, "invalid collation: locale is required")
+	})
+}
+
+func TestReadPreference(t *testing.T) {
+	t.Run("creates the read preference with tag sets and max staleness", func(t *testing.T) {
+		rp, err := newReadPref(ReadPreference{Mode: "secondary", TagSets: []map[string]string{{"workload": "analytics"}, {}}, MaxStalenessSeconds: 120})
+
+		assert.NoError(t, err)
+		assert.Equal(t, readpref.SecondaryMode, rp.Mode())
+		assert.Equal(t, []tag.Set{{{Name: "workload", Value: "analytics"}}, nil}, rp.TagSets(), "an empty tag set falls back to any member")
+		maxStaleness, _ := rp.MaxStaleness()
+		assert.Equal(t, 2*time.Minute, maxStaleness)
+	})
+
+	tests := []struct {
+		name   string
+		rp     ReadPreference
+		errMsg string
+	}{
+		{name: "without mode", rp: ReadPreference{}, errMsg: "mode cannot be empty"},
+		{name: "unknown mode", rp: ReadPreference{Mode: "fastest"}, errMsg: "unknown read preference fastest"},
+		{name: "primary with tag sets", rp: ReadPreference{Mode: "primary", TagSets: []map[string]string{{"dc": "east"}}}, errMsg: "not supported for mode primary"},
+		{name: "small max staleness", rp: ReadPreference{Mode: "nearest", MaxStalenessSeconds: 30}, errMsg: "maxStalenessSeconds must be at least 90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newReadPref(tt.rp)
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestReadConcern(t *testing.T) {
+	rc, err := newReadConcern("majority")
+	assert.NoError(t, err)
+	assert.Equal(t, readconcern.Majority(), rc)
+
+	_, err = newReadConcern("strong")
+	assert.EqualError(t, err, "unsupported level 'strong'")
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	memberStatePrimary = 1
+	memberStateArbiter = 7
+
+	// oplogEntryCommand reads the timestamp of the oldest (1) or newest (-1) oplog entry
+	oplogEntryCommand = `{"find": "oplog.rs", "sort": {"$natural": %d}, "limit": 1, "singleBatch": true, "projection": {"ts": 1, "_id": 0}}`
+)
+
+var (
+	replSetStatusCommand    = mustParseDocument(`{"replSetGetStatus": 1}`)
+	oldestOplogEntryCommand = mustParseDocument(fmt.Sprintf(oplogEntryCommand, 1))
+	newestOplogEntryCommand = mustParseDocument(fmt.Sprintf(oplogEntryCommand, -1))
+)
+
+// replSetCollector exports the member states and replication lag from replSetGetStatus
+// and the oplog window from local.oplog.rs of the target
+type replSetCollector struct {
+	*commandRunner
+	state       *prometheus.Desc
+	health      *prometheus.Desc
+	optime      *prometheus.Desc
+	lag         *prometheus.Desc
+	oplogWindow *prometheus.Desc
+}
+
+// NewReplSetCollector creates a collector exporting state, health, optime and replication lag of all replica set members
+// as well as the oplog window of the given target
+func NewReplSetCollector(t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) BuiltinCollector {
+	memberLabels := []string{"set", "member"}
+	return &replSetCollector{
+		commandRunner: newCommandRunner("replSetGetStatus", t.Name, timeout, con, errorC, metrics),
+		state: prometheus.NewDesc("mongodb_replset_member_state",
+			"State of the replica set member, e.g. 1 for PRIMARY, 2 for SECONDARY and 7 for ARBITER", memberLabels, t.ConstLabels()),
+		health: prometheus.NewDesc("mongodb_replset_member_health",
+			"Health of the replica set member, 1 if it is up and 0 if it is down", memberLabels, t.ConstLabels()),
+		optime: prometheus.NewDesc("mongodb_replset_member_optime_timestamp_seconds",
+			"Unix timestamp of the last operation applied by the replica set member", memberLabels, t.ConstLabels()),
+		lag: prometheus.NewDesc("mongodb_replset_member_replication_lag_seconds",
+			"Replication lag of the replica set member behind the primary in seconds", memberLabels, t.ConstLabels()),
+		oplogWindow: prometheus.NewDesc("mongodb_replset_oplog_window_seconds",
+			"Time span between the oldest and the newest oplog entry of the target in seconds", []string{"set"}, t.ConstLabels()),
+	}
+}
+
+// Describe writes the descriptors of all replica set metrics
+func (c *replSetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.health
+	ch <- c.optime
+	ch <- c.lag
+	ch <- c.oplogWindow
+}
+
+// Collect runs replSetGetStatus and reads the oplog boundaries
+func (c *replSetCollector) Collect(ch chan<- prometheus.Metric) {
+	status, ok := c.run("admin", replSetStatusCommand)
+	if !ok {
+		return
+	}
+	set, _ := status["set"].(string)
+	members, err := lookupDocuments(status, "members")
+	if err != nil {
+		c.fail("admin", "", extractErrorType(err, "invalid_result"), fmt.Errorf("%s returned no members: %w", c.name, err))
+		return
+	}
+
+	primaryOptime, hasPrimary := primaryOptime(members)
+	selfArbiter := false
+	for _, m := range members {
+		name, _ := m["name"].(string)
+		state, err := extractNumber(m, "state", "state")
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, state, set, name)
+		health, err := extractNumber(m, "health", "health")
+		if err == nil {
+			ch <- prometheus.MustNewConstMetric(c.health, prometheus.GaugeValue, health, set, name)
+		}
+		if self, _ := m["self"].(bool); self && state == memberStateArbiter {
+			selfArbiter = true
+		}
+
+		optime, err := extractTime(m, "optimeDate")
+		if err != nil || state == memberStateArbiter {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.optime, prometheus.GaugeValue, unixSeconds(optime), set, name)
+		// Down members report their last known optime, which would show as ever-growing lag
+		if hasPrimary && health == 1 {
+			lag := primaryOptime.Sub(optime).Seconds()
+			if lag < 0 {
+				lag = 0
+			}
+			ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, lag, set, name)
+		}
+	}
+
+	// Arbiters hold no data and thus no oplog
+	if !selfArbiter {
+		c.collectOplogWindow(ch, set)
+	}
+}
+
+// collectOplogWindow exports the time span between the oldest and the newest oplog entry
+func (c *replSetCollector) collectOplogWindow(ch chan<- prometheus.Metric, set string) {
+	first, ok := c.run("local", oldestOplogEntryCommand)
+	if !ok {
+		return
+	}
+	last, ok := c.run("local", newestOplogEntryCommand)
+	if !ok {
+		return
+	}
+	firstTs, err := extractTime(first, "cursor.firstBatch.0.ts")
+	if err != nil {
+		return
+	}
+	lastTs, err := extractTime(last, "cursor.firstBatch.0.ts")
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.oplogWindow, prometheus.GaugeValue, lastTs.Sub(firstTs).Seconds(), set)
+}
+
+// primaryOptime returns the optime of the primary member, if there is one
+func primaryOptime(members []bson.M) (time.Time, bool) {
+	for _, m := range members {
+		state, err := extractNumber(m, "state", "state")
+		if err != nil || state != memberStatePrimary {
+			continue
+		}
+		optime, err := extractTime(m, "optimeDate")
+		if err != nil {
+			return time.Time{}, false
+		}
+		return optime, true
+	}
+	return time.Time{}, false
+}
+
+// extractTime resolves the given attribute path to a date or BSON timestamp
+func extractTime(result bson.M, attribute string) (time.Time, error) {
+	val, err := lookupPath(result, attribute)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch v := val.(type) {
+	case primitive.DateTime:
+		return v.Time(), nil
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0), nil
+	case time.Time:
+		return v, nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value type %T for %s", val, attribute)
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
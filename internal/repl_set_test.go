@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func replSetMock(status bson.M, oldest time.Time, newest time.Time) *mocks.IConnection {
+	con := &mocks.IConnection{}
+	onCommand(con, "admin", replSetStatusCommand, status)
+	onCommand(con, "local", oldestOplogEntryCommand, oplogEntry(oldest))
+	onCommand(con, "local", newestOplogEntryCommand, oplogEntry(newest))
+	return con
+}
+
+func oplogEntry(ts time.Time) bson.M {
+	return bson.M{"cursor": bson.M{"firstBatch": primitive.A{
+		bson.M{"ts": primitive.Timestamp{T: uint32(ts.Unix()), I: 1}},
+	}}}
+}
+
+func member(name string, state int32, health float64, optime time.Time) bson.M {
+	return bson.M{"name": name, "state": state, "health": health, "optimeDate": primitive.NewDateTimeFromTime(optime)}
+}
+
+func TestReplSetCollector(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("exports member states, replication lag and oplog window", func(t *testing.T) {
+		primary := member("db1:27017", 1, 1, now)
+		primary["self"] = true
+		status := bson.M{"set": "rs0", "members": primitive.A{
+			primary,
+			member("db2:27017", 2, 1, now.Add(-5*time.Second)),
+			member("db3:27017", 8, 0, now.Add(-time.Hour)),
+			bson.M{"name": "arbiter:27017", "state": int32(7), "health": 1.0},
+		}}
+		con := replSetMock(status, now.Add(-48*time.Hour), now)
+
+		c := NewReplSetCollector(Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_replset_member_health Health of the replica set member, 1 if it is up and 0 if it is down
+# TYPE mongodb_replset_member_health gauge
+mongodb_replset_member_health{member="arbiter:27017",set="rs0"} 1
+mongodb_replset_member_health{member="db1:27017",set="rs0"} 1
+mongodb_replset_member_health{member="db2:27017",set="rs0"} 1
+mongodb_replset_member_health{member="db3:27017",set="rs0"} 0
+# HELP mongodb_replset_member_replication_lag_seconds Replication lag of the replica set member behind the primary in seconds
+# TYPE mongodb_replset_member_replication_lag_seconds gauge
+mongodb_replset_member_replication_lag_seconds{member="db1:27017",set="rs0"} 0
+mongodb_replset_member_replication_lag_seconds{member="db2:27017",set="rs0"} 5
+# HELP mongodb_replset_member_state State of the replica set member, e.g. 1 for PRIMARY, 2 for SECONDARY and 7 for ARBITER
+# TYPE mongodb_replset_member_state gauge
+mongodb_replset_member_state{member="arbiter:27017",set="rs0"} 7
+mongodb_replset_member_state{member="db1:27017",set="rs0"} 1
+mongodb_replset_member_state{member="db2:27017",set="rs0"} 2
+mongodb_replset_member_state{member="db3:27017",set="rs0"} 8
+# HELP mongodb_replset_oplog_window_seconds Time span between the oldest and the newest oplog entry of the target in seconds
+# TYPE mongodb_replset_oplog_window_seconds gauge
+mongodb_replset_oplog_window_seconds{set="rs0"} 172800
+`
+		err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+			"mongodb_replset_member_health", "mongodb_replset_member_replication_lag_seconds",
+			"mongodb_replset_member_state", "mongodb_replset_oplog_window_seconds")
+		assert.NoError(t, err)
+
+		expectedOptime := `
+# HELP mongodb_replset_member_optime_timestamp_seconds Unix timestamp of the last operation applied by the replica set member
+# TYPE mongodb_replset_member_optime_timestamp_seconds gauge
+mongodb_replset_member_optime_timestamp_seconds{member="db1:27017",set="rs0"} 1.7e+09
+mongodb_replset_member_optime_timestamp_seconds{member="db2:27017",set="rs0"} 1.699999995e+09
+mongodb_replset_member_optime_timestamp_seconds{member="db3:27017",set="rs0"} 1.6999964e+09
+`
+		err = testutil.CollectAndCompare(c, strings.NewReader(expectedOptime), "mongodb_replset_member_optime_timestamp_seconds")
+		assert.NoError(t, err)
+	})
+
+	t.Run("omits the replication lag without primary", func(t *testing.T) {
+		status := bson.M{"set": "rs0", "members": primitive.A{
+			member("db1:27017", 2, 1, now),
+			member("db2:27017", 2, 1, now.Add(-5*time.Second)),
+		}}
+		con := replSetMock(status, now.Add(-time.Hour), now)
+
+		c := NewReplSetCollector(Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		err := testutil.CollectAndCompare(c, strings.NewReader(""), "mongodb_replset_member_replication_lag_seconds")
+		assert.NoError(t, err)
+	})
+
+	t.Run("skips the oplog window on arbiters", func(t *testing.T) {
+		status := bson.M{"set": "rs0", "members": primitive.A{
+			member("db1:27017", 1, 1, now),
+			bson.M{"name": "arbiter:27017", "state": int32(7), "health": 1.0, "self": true},
+		}}
+		con := &mocks.IConnection{}
+		onCommand(con, "admin", replSetStatusCommand, status)
+
+		c := NewReplSetCollector(Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c, "mongodb_replset_oplog_window_seconds"))
+		con.AssertNotCalled(t, "RunCommand", mock.Anything, "local", mock.Anything, mock.Anything)
+	})
+
+	t.Run("counts servers which are no replica set members without reconnecting", func(t *testing.T) {
+		noReplication := mongo.CommandError{Code: 76, Name: "NoReplicationEnabled"}
+		con := &mocks.IConnection{}
+		con.On("RunCommand", mock.Anything, "admin", replSetStatusCommand, mock.Anything).Return(nil, noReplication)
+		errorC := make(chan error, 1)
+		metrics := testMetrics()
+
+		c := NewReplSetCollector(Target{}, 0, con, errorC, metrics)
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.QueryErrors.WithLabelValues("", "replSetGetStatus", "admin", "", "command_failed")))
+		assert.Empty(t, errorC)
+	})
+
+	t.Run("reports connection errors", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		con.On("RunCommand", mock.Anything, "admin", replSetStatusCommand, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+		errorC := make(chan error, 1)
+
+		c := NewReplSetCollector(Target{}, 0, con, errorC, testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+	})
+}
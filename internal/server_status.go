@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/ppussar/mongodb_exporter/internal/wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var serverStatusCommand = mustParseDocument(`{"serverStatus": 1}`)
+
+// serverStatusMetrics are exported from the result of the serverStatus command
+var serverStatusMetrics = []statusMetric{
+	{
+		name:      "mongodb_connections",
+		help:      "Number of incoming connections to the server by state",
+		valueType: prometheus.GaugeValue,
+		label:     "state",
+		attributes: map[string]string{
+			"current":   "connections.current",
+			"available": "connections.available",
+			"active":    "connections.active",
+		},
+	},
+	{
+		name:       "mongodb_connections_created_total",
+		help:       "Total number of incoming connections created",
+		valueType:  prometheus.CounterValue,
+		attributes: map[string]string{"": "connections.totalCreated"},
+	},
+	{
+		name:      "mongodb_op_counters_total",
+		help:      "Total number of database operations by type since the server started",
+		valueType: prometheus.CounterValue,
+		label:     "type",
+		attributes: map[string]string{
+			"insert":  "opcounters.insert",
+			"query":   "opcounters.query",
+			"update":  "opcounters.update",
+			"delete":  "opcounters.delete",
+			"getmore": "opcounters.getmore",
+			"command": "opcounters.command",
+		},
+	},
+	{
+		name:      "mongodb_network_bytes_total",
+		help:      "Total network traffic of the server in bytes by direction",
+		valueType: prometheus.CounterValue,
+		label:     "direction",
+		attributes: map[string]string{
+			"in":  "network.bytesIn",
+			"out": "network.bytesOut",
+		},
+	},
+	{
+		name:       "mongodb_network_requests_total",
+		help:       "Total number of requests received by the server",
+		valueType:  prometheus.CounterValue,
+		attributes: map[string]string{"": "network.numRequests"},
+	},
+	{
+		name:      "mongodb_wiredtiger_cache_bytes",
+		help:      "Size of the data in the WiredTiger cache in bytes by type",
+		valueType: prometheus.GaugeValue,
+		label:     "type",
+		attributes: map[string]string{
+			"total": "wiredTiger.cache.bytes currently in the cache",
+			"dirty": "wiredTiger.cache.tracked dirty bytes in the cache",
+		},
+	},
+	{
+		name:       "mongodb_wiredtiger_cache_max_bytes",
+		help:       "Maximum size of the WiredTiger cache in bytes",
+		valueType:  prometheus.GaugeValue,
+		attributes: map[string]string{"": "wiredTiger.cache.maximum bytes configured"},
+	},
+	{
+		name:      "mongodb_asserts_total",
+		help:      "Total number of raised assertions by type since the server started",
+		valueType: prometheus.CounterValue,
+		label:     "type",
+		attributes: map[string]string{
+			"regular":   "asserts.regular",
+			"warning":   "asserts.warning",
+			"msg":       "asserts.msg",
+			"user":      "asserts.user",
+			"rollovers": "asserts.rollovers",
+		},
+	},
+}
+
+// NewServerStatusCollector creates a collector exporting connections, operation counters, network traffic,
+// WiredTiger cache usage and asserts from the serverStatus command of the given target
+func NewServerStatusCollector(t Target, timeout time.Duration, con wrapper.IConnection, errorC chan error, metrics *Metrics) BuiltinCollector {
+	return newCommandCollector("serverStatus", "admin", serverStatusCommand, serverStatusMetrics, t, timeout, con, errorC, metrics)
+}
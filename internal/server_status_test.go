@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ppussar/mongodb_exporter/internal/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func commandMock(db string, command driverbson.D, doc bson.M) *mocks.IConnection {
+	con := &mocks.IConnection{}
+	onCommand(con, db, command, doc)
+	return con
+}
+
+// onCommand lets the connection mock return the given document for the command
+func onCommand(con *mocks.IConnection, db string, command driverbson.D, doc bson.M) {
+	res := &mocks.ISingleResult{}
+	res.On("Err").Return(nil)
+	res.On("Decode", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		arg := args.Get(0).(*bson.M)
+		*arg = doc
+	})
+	con.On("RunCommand", mock.Anything, db, command, mock.Anything).Return(res, nil)
+}
+
+func TestServerStatusCollector(t *testing.T) {
+	t.Run("exports the attributes of the serverStatus result", func(t *testing.T) {
+		status := bson.M{
+			"connections": bson.M{"current": int32(5), "available": int32(995), "active": int32(2), "totalCreated": int64(42)},
+			"opcounters":  bson.M{"insert": int64(1), "query": int64(2), "update": int64(3), "delete": int64(4), "getmore": int64(5), "command": int64(6)},
+			"network":     bson.M{"bytesIn": int64(100), "bytesOut": int64(200), "numRequests": int64(10)},
+			"wiredTiger": bson.M{"cache": bson.M{
+				"bytes currently in the cache":     int64(1024),
+				"tracked dirty bytes in the cache": int64(16),
+				"maximum bytes configured":         int64(4096),
+			}},
+			"asserts": bson.M{"regular": int32(0), "warning": int32(1), "msg": int32(0), "user": int32(7), "rollovers": int32(0)},
+		}
+		con := commandMock("admin", serverStatusCommand, status)
+
+		c := NewServerStatusCollector(Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_connections Number of incoming connections to the server by state
+# TYPE mongodb_connections gauge
+mongodb_connections{state="active"} 2
+mongodb_connections{state="available"} 995
+mongodb_connections{state="current"} 5
+# HELP mongodb_op_counters_total Total number of database operations by type since the server started
+# TYPE mongodb_op_counters_total counter
+mongodb_op_counters_total{type="command"} 6
+mongodb_op_counters_total{type="delete"} 4
+mongodb_op_counters_total{type="getmore"} 5
+mongodb_op_counters_total{type="insert"} 1
+mongodb_op_counters_total{type="query"} 2
+mongodb_op_counters_total{type="update"} 3
+# HELP mongodb_wiredtiger_cache_bytes Size of the data in the WiredTiger cache in bytes by type
+# TYPE mongodb_wiredtiger_cache_bytes gauge
+mongodb_wiredtiger_cache_bytes{type="dirty"} 16
+mongodb_wiredtiger_cache_bytes{type="total"} 1024
+# HELP mongodb_wiredtiger_cache_max_bytes Maximum size of the WiredTiger cache in bytes
+# TYPE mongodb_wiredtiger_cache_max_bytes gauge
+mongodb_wiredtiger_cache_max_bytes 4096
+`
+		err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+			"mongodb_connections", "mongodb_op_counters_total", "mongodb_wiredtiger_cache_bytes", "mongodb_wiredtiger_cache_max_bytes")
+		assert.NoError(t, err)
+		assert.Equal(t, 21, testutil.CollectAndCount(c))
+	})
+
+	t.Run("skips attributes missing in the result", func(t *testing.T) {
+		status := bson.M{"connections": bson.M{"current": int32(5)}}
+		con := commandMock("admin", serverStatusCommand, status)
+
+		c := NewServerStatusCollector(Target{}, 0, con, make(chan error, 1), testMetrics())
+
+		assert.Equal(t, 1, testutil.CollectAndCount(c))
+	})
+
+	t.Run("labels the metrics with the target", func(t *testing.T) {
+		status := bson.M{"connections": bson.M{"totalCreated": int64(42)}}
+		con := commandMock("admin", serverStatusCommand, status)
+		target := Target{Name: "shard1", Labels: map[string]string{"env": "prod"}}
+
+		c := NewServerStatusCollector(target, 0, con, make(chan error, 1), testMetrics())
+
+		expected := `
+# HELP mongodb_connections_created_total Total number of incoming connections created
+# TYPE mongodb_connections_created_total counter
+mongodb_connections_created_total{env="prod",target="shard1"} 42
+`
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("reports connection errors", func(t *testing.T) {
+		con := &mocks.IConnection{}
+		con.On("RunCommand", mock.Anything, "admin", mock.Anything, mock.Anything).Return(nil, mongo.ErrClientDisconnected)
+		errorC := make(chan error, 1)
+
+		c := NewServerStatusCollector(Target{}, 0, con, errorC, testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.ErrorIs(t, <-errorC, mongo.ErrClientDisconnected)
+	})
+
+	t.Run("reports a missing connection", func(t *testing.T) {
+		errorC := make(chan error, 1)
+
+		c := NewServerStatusCollector(Target{}, 0, nil, errorC, testMetrics())
+
+		assert.Equal(t, 0, testutil.CollectAndCount(c))
+		assert.Contains(t, (<-errorC).Error(), "no MongoDB connection available")
+	})
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// queryTemplate renders the placeholders of a query before each collection
+// Queries without placeholders are returned verbatim.
+type queryTemplate struct {
+	query string
+	tmpl  *template.Template
+	vars  map[string]string
+}
+
+// templateFuncs are available in all queries
+var templateFuncs = template.FuncMap{
+	"now": func() templateTime { return templateTime{} },
+	"env": func(name string) (string, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", name)
+		}
+		return value, nil
+	},
+	// json quotes and escapes a value, so that variables cannot break out of their JSON string
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// parseQueryTemplate parses the placeholders of the query; vars are available as {{ .name }}
+func parseQueryTemplate(name string, query string, vars map[string]string) (*queryTemplate, error) {
+	q := &queryTemplate{query: query, vars: vars}
+	if !strings.Contains(query, "{{") {
+		return q, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	q.tmpl = tmpl
+	return q, nil
+}
+
+// hasPlaceholders reports whether the query has to be rendered before each collection
+func (q *queryTemplate) hasPlaceholders() bool {
+	return q.tmpl != nil
+}
+
+// render returns the query with all placeholders evaluated at the given time
+func (q *queryTemplate) render(now time.Time) (string, error) {
+	if q.tmpl == nil {
+		return q.query, nil
+	}
+	funcs := template.FuncMap{"now": func() templateTime { return templateTime{t: now.UTC()} }}
+	tmpl, err := q.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	vars := q.vars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var sb strings.Builder
+	if err := tmpl.Funcs(funcs).Execute(&sb, vars); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// templateTime is rendered as Extended JSON date, so that it can be compared with date attributes
+type templateTime struct {
+	t time.Time
+}
+
+// Add returns the time shifted by the given duration, e.g. "-5m"
+func (t templateTime) Add(duration string) (templateTime, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return t, err
+	}
+	return templateTime{t: t.t.Add(d)}, nil
+}
+
+// StartOfDay returns midnight UTC of the time
+func (t templateTime) StartOfDay() templateTime {
+	return templateTime{t: t.t.Truncate(24 * time.Hour)}
+}
+
+// StartOfHour returns the beginning of the hour of the time
+func (t templateTime) StartOfHour() templateTime {
+	return templateTime{t: t.t.Truncate(time.Hour)}
+}
+
+// Unix returns the time as seconds since the epoch, e.g. for comparisons with numeric timestamps
+func (t templateTime) Unix() int64 {
+	return t.t.Unix()
+}
+
+// String renders the time as canonical Extended JSON date, which is accepted by the query parser
+func (t templateTime) String() string {
+	return `{"$date": {"$numberLong": "` + strconv.FormatInt(t.t.UnixMilli(), 10) + `"}}`
+}
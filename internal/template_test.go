@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryTemplate(t *testing.T) {
+	now := time.Date(2024, 3, 15, 13, 45, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		vars     map[string]string
+		expected string
+	}{
+		{
+			name:     "query without placeholders",
+			query:    `{"status": "open"}`,
+			expected: `{"status": "open"}`,
+		},
+		{
+			name:     "now",
+			query:    `{"created": {"$lt": {{ now }}}}`,
+			expected: `{"created": {"$lt": {"$date": {"$numberLong": "1710510330000"}}}}`,
+		},
+		{
+			name:     "relative time",
+			query:    `{"created": {"$gte": {{ now.Add "-5m" }}}}`,
+			expected: `{"created": {"$gte": {"$date": {"$numberLong": "1710510030000"}}}}`,
+		},
+		{
+			name:     "start of day and hour",
+			query:    `[{{ now.StartOfDay }}, {{ now.StartOfHour }}, {{ (now.Add "-24h").StartOfDay }}]`,
+			expected: `[{"$date": {"$numberLong": "1710460800000"}}, {"$date": {"$numberLong": "1710507600000"}}, {"$date": {"$numberLong": "1710374400000"}}]`,
+		},
+		{
+			name:     "unix timestamp",
+			query:    `{"ts": {"$gte": {{ (now.Add "-1h").Unix }}}}`,
+			expected: `{"ts": {"$gte": 1710506730}}`,
+		},
+		{
+			name:     "variables",
+			query:    `{"region": "{{ .region }}"}`,
+			vars:     map[string]string{"region": "eu"},
+			expected: `{"region": "eu"}`,
+		},
+		{
+			name:     "escaped variables",
+			query:    `{"name": {{ .name | json }}}`,
+			vars:     map[string]string{"name": `say "hi" \ bye`},
+			expected: `{"name": "say \"hi\" \\ bye"}`,
+		},
+		{
+			name:     "escaped environment variables",
+			query:    `{"tenant": {{ env "QUERY_TEMPLATE_TENANT" | json }}}`,
+			expected: `{"tenant": "acme"}`,
+		},
+		{
+			name:     "environment variables",
+			query:    `{"tenant": "{{ env "QUERY_TEMPLATE_TENANT" }}"}`,
+			expected: `{"tenant": "acme"}`,
+		},
+	}
+	t.Setenv("QUERY_TEMPLATE_TENANT", "acme")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseQueryTemplate("test", tt.query, tt.vars)
+			assert.NoError(t, err)
+
+			actual, err := q.render(now)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("renders valid Extended JSON dates", func(t *testing.T) {
+		q, _ := parseQueryTemplate("test", `{"created": {"$gte": {{ now.Add "-5m" }}}}`, nil)
+		query, _ := q.render(now)
+
+		var filter bson.M
+		assert.NoError(t, bson.UnmarshalExtJSON([]byte(query), true, &filter))
+		assert.Equal(t, now.Add(-5*time.Minute), filter["created"].(bson.M)["$gte"].(interface{ Time() time.Time }).Time().UTC())
+	})
+
+	t.Run("keeps escaped variables within their string", func(t *testing.T) {
+		q, _ := parseQueryTemplate("test", `{"region": {{ .region | json }}}`, map[string]string{"region": `eu", "$where": "1`})
+		query, _ := q.render(now)
+
+		var filter bson.M
+		assert.NoError(t, bson.UnmarshalExtJSON([]byte(query), true, &filter))
+		assert.Equal(t, bson.M{"region": `eu", "$where": "1`}, filter)
+	})
+
+	t.Run("rejects invalid templates", func(t *testing.T) {
+		_, err := parseQueryTemplate("test", `{"created": {{ now }`, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("fails on missing variables", func(t *testing.T) {
+		for _, query := range []string{`"{{ .region }}"`, `"{{ env "QUERY_TEMPLATE_MISSING" }}"`, `{{ now.Add "5 minutes" }}`} {
+			q, err := parseQueryTemplate("test", query, nil)
+			assert.NoError(t, err)
+
+			_, err = q.render(now)
+			assert.Error(t, err, query)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+func validateTLS(c TLS) error {
+	if strings.TrimSpace(c.CertFile) == "" || strings.TrimSpace(c.KeyFile) == "" {
+		return fmt.Errorf("cert_file and key_file are required")
+	}
+	clientAuth, exists := clientAuthTypes[c.ClientAuthType]
+	if !exists {
+		return fmt.Errorf("invalid client_auth_type '%s'", c.ClientAuthType)
+	}
+	if c.ClientCAFile == "" && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return fmt.Errorf("client_auth_type '%s' requires a client_ca_file", c.ClientAuthType)
+	}
+	if _, err := tlsVersion(c.MinVersion, tls.VersionTLS12); err != nil {
+		return err
+	}
+	if _, err := tlsVersion(c.MaxVersion, tls.VersionTLS13); err != nil {
+		return err
+	}
+	_, err := cipherSuites(c.CipherSuites)
+	return err
+}
+
+func tlsVersion(name string, fallback uint16) (uint16, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	version, exists := tlsVersions[name]
+	if !exists {
+		return 0, fmt.Errorf("unknown TLS version '%s'", name)
+	}
+	return version, nil
+}
+
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, exists := known[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// newTLSConfig reads the certificate files and builds the server side TLS config
+func newTLSConfig(c TLS) (*tls.Config, error) {
+	if err := validateTLS(c); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	minVersion, _ := tlsVersion(c.MinVersion, tls.VersionTLS12)
+	maxVersion, _ := tlsVersion(c.MaxVersion, tls.VersionTLS13)
+	suites, _ := cipherSuites(c.CipherSuites)
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuthTypes[c.ClientAuthType],
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+		CipherSuites: suites,
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
+
+// tlsReloadInterval is the interval in which the certificate files are checked for changes
+const tlsReloadInterval = 10 * time.Second
+
+// tlsReloader serves a TLS config which is rebuilt as soon as one of its files changes,
+// so that rotated certificates are used without a restart
+// The files are checked by watch, handshakes only load the current config.
+type tlsReloader struct {
+	config  TLS
+	current atomic.Value // *tls.Config
+	stamp   string
+}
+
+func newTLSReloader(c TLS) (*tlsReloader, error) {
+	r := &tlsReloader{config: c}
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return nil, err
+	}
+	config, err := newTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	r.stamp = stamp
+	r.current.Store(config)
+	return r, nil
+}
+
+// configForClient returns the current TLS config and is used as tls.Config.GetConfigForClient
+func (r *tlsReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return r.current.Load().(*tls.Config), nil
+}
+
+// watch reloads the TLS config in the given interval until done is closed
+func (r *tlsReloader) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.reload()
+		case <-done:
+			return
+		}
+	}
+}
+
+// reload rebuilds the TLS config if one of its files changed
+// If changed files cannot be loaded, the previous config is served until the files change again.
+func (r *tlsReloader) reload() {
+	stamp, err := r.fileStamp()
+	if err != nil || stamp == r.stamp {
+		return
+	}
+	r.stamp = stamp
+	config, err := newTLSConfig(r.config)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to reload TLS config, serving previous certificates: %v", err))
+		return
+	}
+	r.current.Store(config)
+	log.Info("Reloaded TLS certificates")
+}
+
+// fileStamp identifies the current version of all configured files by their size and modification time
+func (r *tlsReloader) fileStamp() (string, error) {
+	var stamp strings.Builder
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%s:%d:%s;", file, info.Size(), info.ModTime().Format(time.RFC3339Nano))
+	}
+	return stamp.String(), nil
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate and its key to the given files
+func writeCertificate(t *testing.T, certFile string, keyFile string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+}
+
+func servedCommonName(t *testing.T, config *tls.Config) string {
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return cert.Subject.CommonName
+}
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      TLS
+		expectedErr string
+	}{
+		{
+			name:   "valid config",
+			config: TLS{CertFile: "server.crt", KeyFile: "server.key", MinVersion: "TLS13", CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}},
+		},
+		{
+			name:        "missing key file",
+			config:      TLS{CertFile: "server.crt"},
+			expectedErr: "cert_file and key_file are required",
+		},
+		{
+			name:        "unknown client auth type",
+			config:      TLS{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "Always"},
+			expectedErr: "invalid client_auth_type 'Always'",
+		},
+		{
+			name:        "client verification without CA",
+			config:      TLS{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "RequireAndVerifyClientCert"},
+			expectedErr: "requires a client_ca_file",
+		},
+		{
+			name:        "unknown version",
+			config:      TLS{CertFile: "server.crt", KeyFile: "server.key", MinVersion: "TLS14"},
+			expectedErr: "unknown TLS version 'TLS14'",
+		},
+		{
+			name:        "unknown cipher suite",
+			config:      TLS{CertFile: "server.crt", KeyFile: "server.key", CipherSuites: []string{"TLS_NONE"}},
+			expectedErr: "unknown cipher suite 'TLS_NONE'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTLS(tt.config)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeCertificate(t, certFile, keyFile, "server")
+
+	config, err := newTLSConfig(TLS{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ClientAuthType: "RequireAndVerifyClientCert",
+		ClientCAFile:   certFile,
+		MaxVersion:     "TLS12",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MaxVersion)
+	assert.Equal(t, "server", servedCommonName(t, config))
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeCertificate(t, certFile, keyFile, "initial")
+
+	reloader, err := newTLSReloader(TLS{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+
+	t.Run("serves the loaded certificate while the files are unchanged", func(t *testing.T) {
+		config, err := reloader.configForClient(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "initial", servedCommonName(t, config))
+	})
+
+	t.Run("serves the previous certificate while the files are invalid", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+		reloader.reload()
+
+		config, err := reloader.configForClient(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "initial", servedCommonName(t, config))
+	})
+
+	t.Run("serves the rotated certificate", func(t *testing.T) {
+		writeCertificate(t, certFile, keyFile, "rotated")
+		reloader.reload()
+
+		config, err := reloader.configForClient(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", servedCommonName(t, config))
+	})
+
+	t.Run("checks the files in the watch interval", func(t *testing.T) {
+		done := make(chan struct{})
+		defer close(done)
+		go reloader.watch(10*time.Millisecond, done)
+
+		writeCertificate(t, certFile, keyFile, "watched")
+
+		assert.Eventually(t, func() bool {
+			config, err := reloader.configForClient(nil)
+			return err == nil && servedCommonName(t, config) == "watched"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("fails on startup without valid certificate", func(t *testing.T) {
+		_, err := newTLSReloader(TLS{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile})
+		assert.Error(t, err)
+	})
+}
@@ -1,11 +1,23 @@
 package wrapper
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
 
 // IConnection interface of mongo.Database
 type IConnection interface {
-	Aggregate(ctx context.Context, db string, collection string, command string) (ICursor, error)
-	Find(ctx context.Context, db string, collection string, command string) (ICursor, error)
+	Aggregate(ctx context.Context, db string, collection string, pipeline bson.A, opts QueryOptions) (ICursor, error)
+	Find(ctx context.Context, db string, collection string, filter bson.D, opts QueryOptions) (ICursor, error)
+	RunCommand(ctx context.Context, db string, command bson.D, opts QueryOptions) (ISingleResult, error)
+	ListCollectionNames(ctx context.Context, db string, filter bson.D) ([]string, error)
+	Watch(ctx context.Context, db string, collection string, pipeline bson.A, resume ResumeToken, opts QueryOptions) (IChangeStream, error)
+	Disconnect(ctx context.Context) error
 }
 
 // ICursor interface of mongo.Cursor
@@ -15,3 +27,45 @@ type ICursor interface {
 	Err() error
 	Close(ctx context.Context) error
 }
+
+// IChangeStream interface of mongo.ChangeStream
+type IChangeStream interface {
+	ICursor
+	ResumeToken() bson.Raw
+}
+
+// ResumeToken continues a change stream after the event of the token; without token the stream starts at the current time
+type ResumeToken struct {
+	Token bson.Raw
+	// StartAfter is required to continue after an invalidate event and is supported by MongoDB 4.2 and newer
+	StartAfter bool
+}
+
+// ISingleResult interface of mongo.SingleResult
+type ISingleResult interface {
+	Decode(val interface{}) error
+	Err() error
+}
+
+// QueryOptions are applied to a single find or aggregate query, database command or change stream
+type QueryOptions struct {
+	// MaxTime limits the server side execution time of the query; zero means no limit
+	MaxTime time.Duration
+
+	// ReadPreference and ReadConcern override the defaults of the connection string if set
+	// The read concern of a database command is part of the command document.
+	ReadPreference *readpref.ReadPref
+	ReadConcern    *readconcern.ReadConcern
+
+	// Projection, Sort, Limit and Skip only apply to find queries; zero values are not applied
+	Projection bson.D
+	Sort       bson.D
+	Limit      int64
+	Skip       int64
+
+	// Hint, Collation and BatchSize apply to find and aggregate queries
+	// Hint is either the name of an index or its key document
+	Hint      interface{}
+	Collation *options.Collation
+	BatchSize int32
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ppussar/mongodb_exporter/exporter"
+	"github.com/ppussar/mongodb_exporter/internal/logger"
+)
+
+var log = logger.GetInstance()
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+	configFile := os.Args[1]
+
+	config, err := exporter.ReadConfigFile(configFile)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to read config: %v", err))
+		os.Exit(1)
+	}
+
+	e, err := exporter.New(config, nil, nil)
+	if err != nil {
+		log.Error(fmt.Sprintf("Invalid config: %v", err))
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := func() error {
+		return e.ReloadFile(configFile)
+	}
+	handleSignals(reload, cancel)
+
+	if err := e.Start(ctx); err != nil {
+		log.Error(fmt.Sprintf("Failed to start exporter: %v", err))
+		os.Exit(1)
+	}
+	if err := e.Serve(ctx, reload); err != nil {
+		log.Error(fmt.Sprintf("Server error: %v", err))
+		os.Exit(1)
+	}
+}
+
+// handleSignals reloads the config on SIGHUP and cancels the exporter on all other signals
+func handleSignals(reload func() error, cancel context.CancelFunc) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+	go func() {
+		for sig := range sigc {
+			if sig == syscall.SIGHUP {
+				log.Info("Received reload signal")
+				if err := reload(); err != nil {
+					log.Error(err.Error())
+				}
+				continue
+			}
+			log.Info("Received shutdown signal")
+			cancel()
+		}
+	}()
+}
+
+func printUsage() {
+	fmt.Printf("Usage: \n\t%s configuration.yaml\n", os.Args[0])
+}